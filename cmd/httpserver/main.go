@@ -1,92 +1,152 @@
 package main
 
 import (
+	"context"
 	"crypto/sha256"
 	"fmt"
 	"httpfromtcp/internal/request"
 	"httpfromtcp/internal/response"
+	"httpfromtcp/internal/router"
 	"httpfromtcp/internal/server"
+	"httpfromtcp/internal/websocket"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
 	"strings"
 	"syscall"
+	"time"
 )
 
 const port = 42069
 
+const shutdownTimeout = 10 * time.Second
+
 func main() {
-	handler := func(w *response.Writer, req *request.Request) {
-		if strings.HasPrefix(req.RequestLine.RequestTarget, "/httpbin/") {
-			suffix := strings.TrimPrefix(req.RequestLine.RequestTarget, "/httpbin/")
-			url := "https://httpbin.org/" + suffix
-
-			resp, err := http.Get(url)
-			if err != nil {
-				w.WriteStatusLine(response.StatusInternalServerError)
-				w.Header.Override("Content-Type", "text/html")
-				w.WriteHeaders()
-				w.WriteBody([]byte("Proxy request failed."))
-				return
+	rt := router.New()
+	rt.Handle(router.AnyMethod, "/httpbin/{rest...}", handleHttpbin)
+	rt.Handle(router.AnyMethod, "/yourproblem", handleYourProblem)
+	rt.Handle(router.AnyMethod, "/myproblem", handleMyProblem)
+	rt.Handle("GET", "/video", handleVideo)
+	rt.Handle("GET", "/events", handleEvents)
+	rt.Handle("GET", "/ws", handleWebSocket)
+	rt.Handle(router.AnyMethod, "/{path...}", handleDefault)
+
+	handler := server.NewChain(logRequests).Then(rt.Serve)
+	server, err := server.Serve(port, handler)
+	if err != nil {
+		log.Fatalf("Error starting server: %v", err)
+	}
+	log.Println("Server started on port", port)
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	<-sigChan
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Shutdown did not finish cleanly: %v", err)
+	}
+	log.Println("\nServer gracefully stopped")
+}
+
+func logRequests(next server.Handler) server.Handler {
+	return func(w *response.Writer, req *request.Request) {
+		start := time.Now()
+		next(w, req)
+		log.Printf("%s %s %d %dB %v", req.RequestLine.Method, req.RequestLine.RequestTarget, w.Status(), w.BytesWritten(), time.Since(start))
+	}
+}
+
+func handleHttpbin(w *response.Writer, req *request.Request) {
+	// PathValue holds decoded segments, so each one is escaped again to
+	// keep an encoded '?' or '/' from changing the upstream URL.
+	var rest []string
+	for _, segment := range req.URL.Segments[1:] {
+		rest = append(rest, url.PathEscape(segment))
+	}
+	target := "https://httpbin.org/" + strings.Join(rest, "/")
+	if req.URL.RawQuery != "" {
+		target += "?" + req.URL.RawQuery
+	}
+
+	// Tied to the request context so the upstream fetch stops as soon as
+	// the client hangs up.
+	upstreamReq, err := http.NewRequestWithContext(req.Context(), "GET", target, nil)
+	if err != nil {
+		w.WriteStatusLine(response.StatusBadGateway)
+		fmt.Fprint(w, "Proxy request failed.")
+		return
+	}
+	resp, err := http.DefaultClient.Do(upstreamReq)
+	if err != nil {
+		w.WriteStatusLine(response.StatusBadGateway)
+		fmt.Fprint(w, "Proxy request failed.")
+		return
+	}
+	defer resp.Body.Close()
+
+	w.WriteStatusLine(response.StatusOK)
+	h := response.GetDefaultHeaders(0)
+	h.Override("Transfer-Encoding", "chunked")
+	h.Override("Trailer", "X-Content-SHA256, X-Content-Length")
+	w.Header = h
+	w.WriteHeaders()
+
+	buf := make([]byte, 1024)
+	var fullBody []byte
+	for {
+		n, readErr := resp.Body.Read(buf)
+		if n > 0 {
+			chunk := buf[:n]
+			fullBody = append(fullBody, chunk...)
+			_, wErr := w.WriteChunkedBody(chunk)
+			if wErr == nil {
+				// Pass each piece on as soon as upstream sends it.
+				wErr = w.Flush()
 			}
-			defer resp.Body.Close()
-
-			w.WriteStatusLine(response.StatusOK)
-			h := response.GetDefaultHeaders(0)
-			h.Override("Transfer-Encoding", "chunked")
-			h.Override("Trailer", "X-Content-SHA256, X-Content-Length")
-			h.Remove("Content-Length")
-			w.Header = h
-			w.WriteHeaders()
-
-			buf := make([]byte, 1024)
-			var fullBody []byte
-			for {
-				n, readErr := resp.Body.Read(buf)
-				if n > 0 {
-					chunk := buf[:n]
-					fullBody = append(fullBody, chunk...)
-					_, wErr := w.WriteChunkedBody(chunk)
-					if wErr != nil {
-						break
-					}
-				}
-				if readErr == io.EOF {
-					break
-				}
-				if readErr != nil {
-					break
-				}
+			if wErr != nil {
+				break
 			}
-
-			sum := sha256.Sum256(fullBody)
-			trailerHeaders := response.NewHeaders()
-			trailerHeaders.Set("X-Content-SHA256", fmt.Sprintf("%x", sum))
-			trailerHeaders.Set("X-Content-Length", fmt.Sprintf("%d", len(fullBody)))
-			w.WriteChunkedBodyDoneWithTrailers(trailerHeaders)
-			return
 		}
-		switch req.RequestLine.RequestTarget {
-		case "/yourproblem":
-			body := []byte(`<html>
-								<head>
-									<title>400 Bad Request</title>
-								</head>
-								<body>
-									<h1>Bad Request</h1>
-									<p>Your request honestly kinda sucked.</p>
-								</body>
-							</html>`)
-			h := response.GetDefaultHeaders(len(body))
-			h.Override("Content-Type", "text/html")
-			w.WriteStatusLine(response.StatusBadRequest)
-			w.Header = h
-			w.WriteHeaders()
-			w.WriteBody(body)
-		case "/myproblem":
-			body := []byte(`<html>
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			break
+		}
+	}
+
+	sum := sha256.Sum256(fullBody)
+	trailerHeaders := response.NewHeaders()
+	trailerHeaders.Set("X-Content-SHA256", fmt.Sprintf("%x", sum))
+	trailerHeaders.Set("X-Content-Length", fmt.Sprintf("%d", len(fullBody)))
+	w.WriteChunkedBodyDoneWithTrailers(trailerHeaders)
+}
+
+func handleYourProblem(w *response.Writer, req *request.Request) {
+	body := []byte(`<html>
+						<head>
+							<title>400 Bad Request</title>
+						</head>
+						<body>
+							<h1>Bad Request</h1>
+							<p>Your request honestly kinda sucked.</p>
+						</body>
+					</html>`)
+	h := response.GetDefaultHeaders(len(body))
+	h.Override("Content-Type", "text/html")
+	w.WriteStatusLine(response.StatusBadRequest)
+	w.Header = h
+	w.WriteHeaders()
+	w.WriteBody(body)
+}
+
+func handleMyProblem(w *response.Writer, req *request.Request) {
+	body := []byte(`<html>
 						<head>
 							<title>500 Internal Server Error</title>
 						</head>
@@ -95,64 +155,82 @@ func main() {
 							<p>Okay, you know what? This one is on me.</p>
 						</body>
 					</html>`)
-			h := response.GetDefaultHeaders(len(body))
-			h.Override("Content-Type", "text/html")
-			w.WriteStatusLine(response.StatusInternalServerError)
-			w.Header = h
-			w.WriteHeaders()
-			w.WriteBody(body)
-		case "/video":
-			if req.RequestLine.Method != "GET" {
-				w.WriteStatusLine(response.StatusBadRequest)
-				w.Header.Override("Content-Type", "text/plain")
-				w.WriteHeaders()
-				w.WriteBody([]byte("Only GET is allowed."))
-				return
-			}
+	h := response.GetDefaultHeaders(len(body))
+	h.Override("Content-Type", "text/html")
+	w.WriteStatusLine(response.StatusInternalServerError)
+	w.Header = h
+	w.WriteHeaders()
+	w.WriteBody(body)
+}
 
-			data, err := os.ReadFile("assets/vim.mp4")
-			if err != nil {
-				w.WriteStatusLine(response.StatusInternalServerError)
-				w.Header.Override("Content-Type", "text/plain")
-				w.WriteHeaders()
-				w.WriteBody([]byte("Failed to load video file."))
+func handleVideo(w *response.Writer, req *request.Request) {
+	f, err := os.Open("assets/vim.mp4")
+	if err != nil {
+		w.WriteStatusLine(response.StatusInternalServerError)
+		fmt.Fprint(w, "Failed to load video file.")
+		return
+	}
+	defer f.Close()
+
+	w.Header.Override("Content-Type", "video/mp4")
+	if info, err := f.Stat(); err == nil {
+		w.Header.Override("Content-Length", fmt.Sprint(info.Size()))
+	}
+	io.Copy(w, f)
+}
+
+// handleEvents streams the server time once a second for ten seconds.
+func handleEvents(w *response.Writer, req *request.Request) {
+	stream, err := response.NewEventStream(req.Context(), w)
+	if err != nil {
+		return
+	}
+	events := make(chan response.Event)
+	go func() {
+		defer close(events)
+		for i := 1; i <= 10; i++ {
+			select {
+			case events <- response.Event{ID: fmt.Sprint(i), Event: "tick", Data: time.Now().Format(time.RFC3339)}:
+			case <-stream.Done():
 				return
 			}
+			time.Sleep(time.Second)
+		}
+	}()
+	stream.Serve(events, 15*time.Second)
+}
 
-			w.WriteStatusLine(response.StatusOK)
-			h := response.GetDefaultHeaders(len(data))
-			h.Override("Content-Type", "video/mp4")
-			w.Header = h
-			w.WriteHeaders()
-			w.WriteBody(data)
+func handleWebSocket(w *response.Writer, req *request.Request) {
+	conn, err := websocket.Upgrade(w, req)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	for {
+		typ, msg, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if err := conn.WriteMessage(typ, msg); err != nil {
 			return
-		default:
-			body := []byte(`<html>
-								<head>
-									<title>200 OK</title>
-								</head>
-								<body>
-									<h1>Success!</h1>
-									<p>Your request was an absolute banger.</p>
-								</body>
-							</html>`)
-			h := response.GetDefaultHeaders(len(body))
-			h.Override("Content-Type", "text/html")
-			w.WriteStatusLine(response.StatusOK)
-			w.Header = h
-			w.WriteHeaders()
-			w.WriteBody(body)
 		}
 	}
-	server, err := server.Serve(port, handler)
-	if err != nil {
-		log.Fatalf("Error starting server: %v", err)
-	}
-	defer server.Close()
-	log.Println("Server started on port", port)
+}
 
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	<-sigChan
-	log.Println("\nServer gracefully stopped")
-}
\ No newline at end of file
+func handleDefault(w *response.Writer, req *request.Request) {
+	body := []byte(`<html>
+						<head>
+							<title>200 OK</title>
+						</head>
+						<body>
+							<h1>Success!</h1>
+							<p>Your request was an absolute banger.</p>
+						</body>
+					</html>`)
+	h := response.GetDefaultHeaders(len(body))
+	h.Override("Content-Type", "text/html")
+	w.WriteStatusLine(response.StatusOK)
+	w.Header = h
+	w.WriteHeaders()
+	w.WriteBody(body)
+}
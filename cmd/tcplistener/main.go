@@ -6,6 +6,7 @@ import (
 	"io"
 	"log"
 	"net"
+	"os"
 )
 
 func main() {
@@ -41,11 +42,16 @@ func handleConnection(conn io.ReadCloser) {
 	fmt.Println("- Target:", req.RequestLine.RequestTarget)
 	fmt.Println("- Version:", req.RequestLine.HttpVersion)
 	fmt.Println("Headers:")
-	for key, value := range req.Headers {
-		fmt.Printf("- %s: %s\n", key, value)
+	for _, key := range req.Headers.Keys() {
+		for _, value := range req.Headers.Values(key) {
+			fmt.Printf("- %s: %s\n", key, value)
+		}
 	}
 	fmt.Println("Body:")
-	fmt.Printf("%s", req.Body)
+	if _, err := io.Copy(os.Stdout, req.Body); err != nil {
+		fmt.Println("Failed to read body:", err)
+		return
+	}
 	fmt.Println("...")
 
 	fmt.Println("Connection closed")
@@ -2,16 +2,48 @@ package headers
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"sort"
 	"strings"
 )
 
-type Headers map[string]string
+// Headers maps lowercased field names to their values, one entry per field
+// line in the order the lines were added.
+type Headers map[string][]string
 
 const crlf = "\r\n"
 
+var (
+	ErrMalformedFieldLine = errors.New("malformed header field line")
+	ErrInvalidFieldName   = errors.New("invalid header field name")
+	ErrInvalidFieldValue  = errors.New("invalid header field value")
+)
+
 var tcharTable [256]bool
 
+// Fields that carry framing, routing, authentication or similar control
+// data and therefore must not be sent in a trailer section (RFC 9110 6.5.1).
+var forbiddenTrailers = map[string]bool{
+	"transfer-encoding":   true,
+	"content-length":      true,
+	"content-encoding":    true,
+	"content-type":        true,
+	"content-range":       true,
+	"trailer":             true,
+	"host":                true,
+	"te":                  true,
+	"expect":              true,
+	"max-forwards":        true,
+	"cache-control":       true,
+	"pragma":              true,
+	"range":               true,
+	"authorization":       true,
+	"proxy-authorization": true,
+	"cookie":              true,
+	"set-cookie":          true,
+}
+
 func init() {
 	for c := 'a'; c <= 'z'; c++ {
 		tcharTable[c] = true
@@ -38,44 +70,99 @@ func (h Headers) Parse(data []byte) (n int, done bool, err error) {
 	}
 
 	line := data[:idx]
+	// A line starting with whitespace continues the previous one (obs-fold),
+	// and a lone CR or LF inside a line is a line ending to some parsers but
+	// not others. Either can be used to hide fields from one of them, so both
+	// are rejected (RFC 9112 2.2 and 5.2).
+	if line[0] == ' ' || line[0] == '\t' {
+		return 0, false, fmt.Errorf("%w: obsolete line folding", ErrMalformedFieldLine)
+	}
+	if bytes.ContainsAny(line, "\r\n") {
+		return 0, false, fmt.Errorf("%w: bare CR or LF", ErrMalformedFieldLine)
+	}
 	parts := bytes.SplitN(line, []byte(":"), 2)
 	if len(parts) != 2 {
-		return 0, false, fmt.Errorf("malformed header line (no colon): %q", line)
+		return 0, false, fmt.Errorf("%w (no colon): %q", ErrMalformedFieldLine, line)
 	}
 
 	rawKey := string(parts[0])
 	if strings.TrimSpace(rawKey) != rawKey {
-		return 0, false, fmt.Errorf("invalid header: space before colon")
+		return 0, false, fmt.Errorf("%w: space before colon", ErrInvalidFieldName)
 	}
 	if rawKey == "" {
-		return 0, false, fmt.Errorf("empty header key")
+		return 0, false, fmt.Errorf("%w: empty name", ErrInvalidFieldName)
 	}
-	if !isValidHeaderField(rawKey) {
-		return 0, false, fmt.Errorf("invalid header: bad character in %q", rawKey)
+	if !ValidFieldName(rawKey) {
+		return 0, false, fmt.Errorf("%w: bad character in %q", ErrInvalidFieldName, rawKey)
 	}
 
 	key := strings.ToLower(rawKey)
-	value := strings.TrimSpace(string(parts[1]))
-	h.Set(key, value)
+	value := strings.Trim(string(parts[1]), " \t")
+	if !ValidFieldValue(value) {
+		return 0, false, fmt.Errorf("%w for %s", ErrInvalidFieldValue, key)
+	}
+	h.Add(key, value)
 
 	return idx + len(crlf), false, nil
 }
 
-func (h Headers) Set(key, value string) {
+// Add appends value as a separate field line for key.
+func (h Headers) Add(key, value string) {
 	key = strings.ToLower(key)
-	if existing, ok := h[key]; ok {
-		h[key] = existing + ", " + value
-	} else {
-		h[key] = value
-	}
+	h[key] = append(h[key], value)
 }
 
+// Values returns the value of every field line for key, in order. The
+// returned slice must not be modified.
+func (h Headers) Values(key string) []string {
+	return h[strings.ToLower(key)]
+}
+
+// Del removes every field line for key.
+func (h Headers) Del(key string) {
+	delete(h, strings.ToLower(key))
+}
+
+// Set adds value for key. It is kept as an alias of Add; Get is what combines
+// the values of repeated fields.
+func (h Headers) Set(key, value string) {
+	h.Add(key, value)
+}
+
+// Get returns the values for key combined into one comma-separated list, as
+// a recipient may do for repeated fields (RFC 9110 5.3). Set-Cookie values
+// contain commas and can't be combined, so only the first is returned; use
+// Values for all of them.
 func (h Headers) Get(key string) string {
-	key = strings.ToLower(key)
-	return h[key]
+	values := h.Values(key)
+	if len(values) == 0 {
+		return ""
+	}
+	if strings.EqualFold(key, "Set-Cookie") {
+		return values[0]
+	}
+	return strings.Join(values, ", ")
 }
 
-func isValidHeaderField(s string) bool {
+// HasToken reports whether the comma-separated list in the named field
+// contains token, compared case-insensitively.
+func (h Headers) HasToken(key, token string) bool {
+	for _, value := range h.Values(key) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ValidFieldName reports whether s is a non-empty token as required for
+// field names (RFC 9110 5.1).
+func ValidFieldName(s string) bool {
+	if s == "" {
+		return false
+	}
 	for i := 0; i < len(s); i++ {
 		if s[i] >= 128 || !tcharTable[s[i]] {
 			return false
@@ -84,15 +171,83 @@ func isValidHeaderField(s string) bool {
 	return true
 }
 
+// ValidFieldValue reports whether s is free of CR, LF and NUL, which would
+// let a value end its field line early or be mangled by recipients.
+func ValidFieldValue(s string) bool {
+	return !strings.ContainsAny(s, "\r\n\x00")
+}
+
+// Validate returns an error wrapping ErrInvalidFieldName or
+// ErrInvalidFieldValue for the first field, in Keys order, that can't be
+// serialised safely.
+func (h Headers) Validate() error {
+	for _, key := range h.Keys() {
+		if !ValidFieldName(key) {
+			return fmt.Errorf("%w: %q", ErrInvalidFieldName, key)
+		}
+		for _, value := range h[key] {
+			if !ValidFieldValue(value) {
+				return fmt.Errorf("%w for %s: %q", ErrInvalidFieldValue, key, value)
+			}
+		}
+	}
+	return nil
+}
+
 func NewHeaders() Headers {
 	return make(Headers)
 }
 
+// Override replaces every field line for key with a single one.
 func (h Headers) Override(key, value string) {
 	key = strings.ToLower(key)
-	h[key] = value
+	h[key] = []string{value}
 }
 
-func (h Headers) Remove(key string) {
-	delete(h, strings.ToLower(key))
-}
\ No newline at end of file
+// Field names whose conventional spelling isn't plain Title-Case.
+var canonicalExceptions = map[string]string{
+	"dnt":                      "DNT",
+	"etag":                     "ETag",
+	"sec-websocket-accept":     "Sec-WebSocket-Accept",
+	"sec-websocket-extensions": "Sec-WebSocket-Extensions",
+	"sec-websocket-key":        "Sec-WebSocket-Key",
+	"sec-websocket-protocol":   "Sec-WebSocket-Protocol",
+	"sec-websocket-version":    "Sec-WebSocket-Version",
+	"te":                       "TE",
+	"www-authenticate":         "WWW-Authenticate",
+	"x-xss-protection":         "X-XSS-Protection",
+}
+
+// CanonicalName returns the conventional spelling of a field name:
+// Title-Case with each hyphen-separated word capitalised, e.g.
+// "content-length" becomes "Content-Length".
+func CanonicalName(key string) string {
+	key = strings.ToLower(key)
+	if name, ok := canonicalExceptions[key]; ok {
+		return name
+	}
+	b := []byte(key)
+	upper := true
+	for i, c := range b {
+		if upper && c >= 'a' && c <= 'z' {
+			b[i] = c - ('a' - 'A')
+		}
+		upper = c == '-'
+	}
+	return string(b)
+}
+
+// Keys returns the field names in h in sorted order, so that serialising h
+// always produces the same output.
+func (h Headers) Keys() []string {
+	keys := make([]string, 0, len(h))
+	for key := range h {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func IsForbiddenTrailer(key string) bool {
+	return forbiddenTrailers[strings.ToLower(key)]
+}
@@ -14,7 +14,7 @@ func TestHeadersParse(t *testing.T) {
 	n, done, err := headers.Parse(data)
 	require.NoError(t, err)
 	require.NotNil(t, headers)
-	assert.Equal(t, "localhost:42069", headers["host"])
+	assert.Equal(t, "localhost:42069", headers.Get("host"))
 	assert.Equal(t, 23, n)
 	assert.False(t, done)
 
@@ -28,12 +28,12 @@ func TestHeadersParse(t *testing.T) {
 
 	// Test: Valid 2 headers with existing headers
 	headers = NewHeaders()
-	headers["User-Agent"] = "curl"
+	headers.Set("User-Agent", "curl")
 	data = []byte("Accept: */*\r\n")
 	n, done, err = headers.Parse(data)
 	require.NoError(t, err)
-	assert.Equal(t, "curl", headers["User-Agent"])
-	assert.Equal(t, "*/*", headers["accept"])
+	assert.Equal(t, "curl", headers.Get("User-Agent"))
+	assert.Equal(t, "*/*", headers.Get("accept"))
 	assert.Equal(t, len(data), n)
 	assert.False(t, done)
 
@@ -45,11 +45,19 @@ func TestHeadersParse(t *testing.T) {
 	assert.Equal(t, 2, n)
 	assert.True(t, done)
 
-	// Test: Invalid spacing header (space before colon)
+	// Test: Invalid spacing header
 	headers = NewHeaders()
 	data = []byte("  Host : localhost:42069\r\n")
 	n, done, err = headers.Parse(data)
-	require.Error(t, err)
+	require.ErrorIs(t, err, ErrMalformedFieldLine)
+	assert.Equal(t, 0, n)
+	assert.False(t, done)
+
+	// Test: Space before colon
+	headers = NewHeaders()
+	data = []byte("Host : localhost:42069\r\n")
+	n, done, err = headers.Parse(data)
+	require.ErrorIs(t, err, ErrInvalidFieldName)
 	assert.Equal(t, 0, n)
 	assert.False(t, done)
 
@@ -57,7 +65,7 @@ func TestHeadersParse(t *testing.T) {
 	headers = NewHeaders()
 	data = []byte("H@st: localhost:42069\r\n")
 	n, done, err = headers.Parse(data)
-	require.Error(t, err)
+	require.ErrorIs(t, err, ErrInvalidFieldName)
 	assert.Equal(t, 0, n)
 	assert.False(t, done)
 
@@ -66,17 +74,95 @@ func TestHeadersParse(t *testing.T) {
 	data = []byte("HOST: LOCALhoST:42069\r\n")
 	n, done, err = headers.Parse(data)
 	require.NoError(t, err)
-	assert.Equal(t, "LOCALhoST:42069", headers["host"])
+	assert.Equal(t, "LOCALhoST:42069", headers.Get("host"))
 	assert.Equal(t, len(data), n)
 	assert.False(t, done)
 
 	// Test: Multiple values for single header key
 	headers = NewHeaders()
-	headers["host"] = "localhost:42069"
+	headers.Set("Host", "localhost:42069")
 	data = []byte("Host: localhost:33333\r\n")
 	n, done, err = headers.Parse(data)
 	require.NoError(t, err)
-	assert.Equal(t, "localhost:42069, localhost:33333", headers["host"])
+	assert.Equal(t, "localhost:42069, localhost:33333", headers.Get("host"))
+	assert.Equal(t, []string{"localhost:42069", "localhost:33333"}, headers.Values("host"))
 	assert.Equal(t, len(data), n)
 	assert.False(t, done)
-}
\ No newline at end of file
+}
+
+func TestHeadersParseMissingColon(t *testing.T) {
+	headers := NewHeaders()
+	n, done, err := headers.Parse([]byte("Host localhost\r\n\r\n"))
+	require.ErrorIs(t, err, ErrMalformedFieldLine)
+	assert.Equal(t, 0, n)
+	assert.False(t, done)
+}
+
+func TestHeadersHasToken(t *testing.T) {
+	headers := NewHeaders()
+	headers.Set("Connection", "keep-alive, Upgrade")
+	assert.True(t, headers.HasToken("connection", "upgrade"))
+	assert.True(t, headers.HasToken("Connection", "Keep-Alive"))
+	assert.False(t, headers.HasToken("Connection", "close"))
+	assert.False(t, headers.HasToken("Transfer-Encoding", "chunked"))
+}
+
+func TestCanonicalName(t *testing.T) {
+	assert.Equal(t, "Content-Length", CanonicalName("content-length"))
+	assert.Equal(t, "Content-Type", CanonicalName("CONTENT-TYPE"))
+	assert.Equal(t, "Host", CanonicalName("host"))
+	assert.Equal(t, "X-Forwarded-For", CanonicalName("x-forwarded-for"))
+	assert.Equal(t, "TE", CanonicalName("te"))
+	assert.Equal(t, "ETag", CanonicalName("etag"))
+	assert.Equal(t, "Sec-WebSocket-Accept", CanonicalName("sec-websocket-accept"))
+	assert.Equal(t, "X-1st-Try", CanonicalName("x-1st-try"))
+}
+
+func TestHeadersMultiValued(t *testing.T) {
+	headers := NewHeaders()
+	headers.Add("Accept", "text/html")
+	headers.Add("accept", "*/*")
+	assert.Equal(t, []string{"text/html", "*/*"}, headers.Values("ACCEPT"))
+	assert.Equal(t, "text/html, */*", headers.Get("Accept"))
+
+	// Test: Set-Cookie values are never folded
+	headers.Add("Set-Cookie", "a=1; Expires=Wed, 21 Oct 2026 07:28:00 GMT")
+	headers.Add("Set-Cookie", "b=2")
+	assert.Equal(t, "a=1; Expires=Wed, 21 Oct 2026 07:28:00 GMT", headers.Get("set-cookie"))
+	assert.Len(t, headers.Values("Set-Cookie"), 2)
+
+	// Test: Override replaces every field line
+	headers.Override("Accept", "application/json")
+	assert.Equal(t, []string{"application/json"}, headers.Values("Accept"))
+
+	// Test: Del removes the field
+	headers.Del("Set-Cookie")
+	assert.Nil(t, headers.Values("Set-Cookie"))
+	assert.Equal(t, "", headers.Get("Set-Cookie"))
+}
+
+func TestHeadersValidate(t *testing.T) {
+	headers := NewHeaders()
+	headers.Set("X-Foo", "a, b\tc")
+	require.NoError(t, headers.Validate())
+
+	headers.Set("X-Foo", "a\r\nSet-Cookie: evil")
+	assert.ErrorIs(t, headers.Validate(), ErrInvalidFieldValue)
+
+	headers = NewHeaders()
+	headers.Set("X-Nul", "a\x00b")
+	assert.ErrorIs(t, headers.Validate(), ErrInvalidFieldValue)
+
+	headers = NewHeaders()
+	headers.Set("X Foo", "a")
+	assert.ErrorIs(t, headers.Validate(), ErrInvalidFieldName)
+
+	headers = NewHeaders()
+	headers.Set("X-Foo\r\nEvil", "a")
+	assert.ErrorIs(t, headers.Validate(), ErrInvalidFieldName)
+
+	// Test: Parse rejects NUL in values
+	headers = NewHeaders()
+	_, _, err := headers.Parse([]byte("X-Foo: a\x00b\r\n"))
+	assert.ErrorIs(t, err, ErrInvalidFieldValue)
+}
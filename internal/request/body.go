@@ -0,0 +1,236 @@
+package request
+
+import (
+	"fmt"
+	"httpfromtcp/internal/headers"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Transfer codings registered with IANA. Only chunked is implemented; the
+// others are recognised so they can be told apart from garbage.
+var transferCodings = map[string]bool{
+	"chunked":    true,
+	"compress":   true,
+	"deflate":    true,
+	"gzip":       true,
+	"x-compress": true,
+	"x-gzip":     true,
+}
+
+// checkTransferCodings accepts only a plain chunked body. Unknown or
+// unsupported codings get a 501; a list where chunked isn't applied exactly
+// once and last leaves the body length undeterminable and gets a 400.
+func checkTransferCodings(values []string) error {
+	var codings []string
+	for _, value := range values {
+		for _, coding := range strings.Split(value, ",") {
+			coding, _, _ = strings.Cut(coding, ";")
+			coding = strings.ToLower(strings.Trim(coding, " \t"))
+			if coding == "" {
+				continue
+			}
+			if !transferCodings[coding] {
+				return newError(ErrUnsupportedTransferCoding, coding)
+			}
+			codings = append(codings, coding)
+		}
+	}
+	if len(codings) == 0 {
+		return newError(ErrInvalidTransferEncoding, "empty")
+	}
+	if codings[len(codings)-1] != "chunked" {
+		return newError(ErrInvalidTransferEncoding, "chunked is not the final coding")
+	}
+	if slices.Contains(codings[:len(codings)-1], "chunked") {
+		return newError(ErrInvalidTransferEncoding, "chunked applied more than once")
+	}
+	// Only chunked itself is decoded; other codings would have to be
+	// removed before the body could be handed out.
+	if len(codings) > 1 {
+		return newError(ErrUnsupportedTransferCoding, codings[0])
+	}
+	return nil
+}
+
+// parseContentLength accepts repeated Content-Length fields or list members
+// only when they all carry the same value (RFC 9110 8.6).
+func parseContentLength(values []string) (int64, error) {
+	if strings.Trim(strings.Join(values, ""), " \t") == "" {
+		return 0, newError(ErrLengthRequired, "empty Content-Length")
+	}
+	contentLen := int64(-1)
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			part = strings.Trim(part, " \t")
+			n, err := strconv.ParseInt(part, 10, 64)
+			if part == "" || !isDigit(part[0]) || err != nil {
+				return 0, newError(ErrInvalidContentLength, part)
+			}
+			if contentLen != -1 && n != contentLen {
+				return 0, newError(ErrInvalidContentLength, "conflicting values")
+			}
+			contentLen = n
+		}
+	}
+	return contentLen, nil
+}
+
+// body decodes the request content directly from the connection's Reader as
+// the handler consumes it.
+type body struct {
+	req    *Request
+	rr     *Reader
+	closed bool
+	done   bool
+	err    error
+}
+
+// startBody determines the body length as RFC 9112 6.3 prescribes. Requests
+// whose framing different parsers could disagree on are rejected rather than
+// guessed at, since that disagreement is what request smuggling exploits.
+func (r *Request) startBody(rr *Reader) error {
+	te := r.Headers.Values("Transfer-Encoding")
+	cl := r.Headers.Values("Content-Length")
+	switch {
+	case len(te) > 0:
+		// HTTP/1.0 has no transfer codings, so the body length has to come
+		// from Content-Length.
+		if r.RequestLine.HttpVersion == "1.0" {
+			return newError(ErrLengthRequired, "Transfer-Encoding in HTTP/1.0 request")
+		}
+		if len(cl) > 0 {
+			return newError(ErrAmbiguousLength, "")
+		}
+		if err := checkTransferCodings(te); err != nil {
+			return err
+		}
+		r.ContentLength = -1
+		// Allocated up front so copies made by WithContext share the
+		// trailers filled in once the body has been read.
+		r.Trailers = headers.NewHeaders()
+		r.state = requestStateParsingChunkSize
+	case len(cl) > 0:
+		contentLen, err := parseContentLength(cl)
+		if err != nil {
+			return err
+		}
+		if r.limits.bodyTooLarge(contentLen) {
+			return newError(ErrBodyTooLarge, "")
+		}
+		r.ContentLength = contentLen
+		r.bodyRemaining = contentLen
+		r.state = requestStateParsingBody
+		if contentLen == 0 {
+			r.state = requestStateDone
+		}
+	default:
+		r.state = requestStateDone
+	}
+
+	b := &body{req: r, rr: rr}
+	r.Body = b
+	r.bodyDone = make(chan struct{})
+	if r.state == requestStateDone {
+		b.done = true
+		close(r.bodyDone)
+	}
+	return nil
+}
+
+func (b *body) Read(p []byte) (int, error) {
+	if b.closed {
+		return 0, fmt.Errorf("read on closed request body")
+	}
+	return b.read(p)
+}
+
+func (b *body) Close() error {
+	b.closed = true
+	return nil
+}
+
+func (b *body) read(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	n, err := b.readSingle(p)
+	if err != nil {
+		b.err = err
+	}
+	if !b.done && b.req.state == requestStateDone {
+		b.done = true
+		close(b.req.bodyDone)
+	}
+	return n, err
+}
+
+func (b *body) readSingle(p []byte) (int, error) {
+	r := b.req
+	for {
+		switch r.state {
+		case requestStateDone:
+			return 0, io.EOF
+
+		case requestStateParsingBody, requestStateParsingChunkData:
+			if len(p) == 0 {
+				return 0, nil
+			}
+			if int64(len(p)) > r.bodyRemaining {
+				p = p[:r.bodyRemaining]
+			}
+			n, err := b.rr.readData(p)
+			r.bodyRemaining -= int64(n)
+			r.bodyRead += int64(n)
+			if r.limits.bodyTooLarge(r.bodyRead) {
+				return 0, newError(ErrBodyTooLarge, "")
+			}
+			if r.bodyRemaining == 0 {
+				if r.state == requestStateParsingBody {
+					r.state = requestStateDone
+				} else {
+					r.state = requestStateParsingChunkDataEnd
+				}
+			}
+			return n, err
+
+		default:
+			parsed, err := r.parse(b.rr.buffered())
+			if err != nil {
+				return 0, err
+			}
+			b.rr.consume(parsed)
+			if parsed > 0 {
+				continue
+			}
+			err = b.rr.fill()
+			if err == io.EOF {
+				return 0, io.ErrUnexpectedEOF
+			}
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+}
+
+// DrainBody discards whatever the handler left unread, up to limit bytes, so
+// the next request on the connection can be parsed. It reports false when the
+// body is longer than that or can't be read, in which case the connection
+// can't be reused.
+func (r *Request) DrainBody(limit int64) bool {
+	b, ok := r.Body.(*body)
+	if !ok {
+		return false
+	}
+	n, err := io.CopyN(io.Discard, readerFunc(b.read), limit+1)
+	return err == io.EOF && n <= limit
+}
+
+type readerFunc func(p []byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) {
+	return f(p)
+}
@@ -0,0 +1,79 @@
+package request
+
+import "errors"
+
+var (
+	ErrMalformedRequestLine      = errors.New("malformed request line")
+	ErrInvalidMethod             = errors.New("invalid method")
+	ErrInvalidTarget             = errors.New("invalid request target")
+	ErrUnsupportedVersion        = errors.New("unsupported HTTP version")
+	ErrRequestLineTooLong        = errors.New("request line too long")
+	ErrMalformedHeader           = errors.New("malformed header field")
+	ErrHeaderTooLarge            = errors.New("request header fields too large")
+	ErrInvalidContentLength      = errors.New("invalid Content-Length")
+	ErrLengthRequired            = errors.New("Content-Length required")
+	ErrBodyTooLarge              = errors.New("request body too large")
+	ErrUnsupportedTransferCoding = errors.New("unsupported transfer coding")
+	ErrInvalidTransferEncoding   = errors.New("invalid Transfer-Encoding")
+	ErrAmbiguousLength           = errors.New("both Transfer-Encoding and Content-Length")
+	ErrMalformedChunk            = errors.New("malformed chunk")
+	ErrForbiddenTrailer          = errors.New("forbidden trailer field")
+	ErrIncompleteRequest         = errors.New("incomplete request")
+)
+
+var statusCodes = map[error]int{
+	ErrMalformedRequestLine:      400,
+	ErrInvalidMethod:             400,
+	ErrInvalidTarget:             400,
+	ErrUnsupportedVersion:        505,
+	ErrRequestLineTooLong:        414,
+	ErrMalformedHeader:           400,
+	ErrHeaderTooLarge:            431,
+	ErrInvalidContentLength:      400,
+	ErrLengthRequired:            411,
+	ErrBodyTooLarge:              413,
+	ErrUnsupportedTransferCoding: 501,
+	ErrInvalidTransferEncoding:   400,
+	ErrAmbiguousLength:           400,
+	ErrMalformedChunk:            400,
+	ErrForbiddenTrailer:          400,
+	ErrIncompleteRequest:         400,
+}
+
+// Error is returned for requests that can't be served. It wraps one of the
+// Err values above, or an error from the headers package, together with the
+// status code the server should answer with.
+type Error struct {
+	StatusCode int
+	Err        error
+	Detail     string
+}
+
+func newError(err error, detail string) *Error {
+	return &Error{
+		StatusCode: statusCodes[err],
+		Err:        err,
+		Detail:     detail,
+	}
+}
+
+func (e *Error) Error() string {
+	if e.Detail == "" {
+		return e.Err.Error()
+	}
+	return e.Err.Error() + ": " + e.Detail
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// StatusCode returns the status code to answer err with, defaulting to 400
+// for errors that don't carry one.
+func StatusCode(err error) int {
+	var reqErr *Error
+	if errors.As(err, &reqErr) && reqErr.StatusCode != 0 {
+		return reqErr.StatusCode
+	}
+	return 400
+}
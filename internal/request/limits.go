@@ -0,0 +1,46 @@
+package request
+
+const (
+	DefaultMaxRequestLineBytes = 8 << 10
+	DefaultMaxHeaderBytes      = 1 << 20
+	DefaultMaxHeaderCount      = 100
+
+	maxChunkSizeLineBytes = 4 << 10
+)
+
+// Limits bounds how much a single request may make the parser buffer. Zero
+// fields fall back to the defaults, except MaxBodyBytes where zero means the
+// body size is not limited.
+type Limits struct {
+	MaxRequestLineBytes int
+	// MaxHeaderBytes and MaxHeaderCount also cover the trailer section of
+	// chunked bodies.
+	MaxHeaderBytes int
+	MaxHeaderCount int
+	MaxBodyBytes   int64
+}
+
+func (l Limits) maxRequestLineBytes() int {
+	if l.MaxRequestLineBytes <= 0 {
+		return DefaultMaxRequestLineBytes
+	}
+	return l.MaxRequestLineBytes
+}
+
+func (l Limits) maxHeaderBytes() int {
+	if l.MaxHeaderBytes <= 0 {
+		return DefaultMaxHeaderBytes
+	}
+	return l.MaxHeaderBytes
+}
+
+func (l Limits) maxHeaderCount() int {
+	if l.MaxHeaderCount <= 0 {
+		return DefaultMaxHeaderCount
+	}
+	return l.MaxHeaderCount
+}
+
+func (l Limits) bodyTooLarge(n int64) bool {
+	return l.MaxBodyBytes > 0 && n > l.MaxBodyBytes
+}
@@ -2,6 +2,7 @@ package request
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"httpfromtcp/internal/headers"
 	"io"
@@ -11,9 +12,24 @@ import (
 
 type Request struct {
 	RequestLine RequestLine
+	// URL is RequestLine.RequestTarget parsed according to its form.
+	URL URL
 	Headers headers.Headers
-	Body []byte
+	// Body streams the request content from the connection. Trailers are
+	// only populated once a chunked Body has been read to EOF.
+	Body io.ReadCloser
+	// ContentLength is -1 for chunked bodies and 0 when there is no body.
+	ContentLength int64
+	Trailers headers.Headers
+	pathValues map[string]string
+	ctx context.Context
 	state requestState
+	limits Limits
+	headerBytes int
+	headerCount int
+	bodyRemaining int64
+	bodyRead int64
+	bodyDone chan struct{}
 }
 
 type RequestLine struct {
@@ -28,6 +44,10 @@ const (
 	requestStateInitialized requestState = iota
 	requestStateParsingHeaders
 	requestStateParsingBody
+	requestStateParsingChunkSize
+	requestStateParsingChunkData
+	requestStateParsingChunkDataEnd
+	requestStateParsingTrailers
 	requestStateDone
 )
 
@@ -35,44 +55,138 @@ const crlf = "\r\n"
 
 const bufferSize = 8
 
-func RequestFromReader(reader io.Reader) (*Request, error) {
-	buf := make([]byte, bufferSize)
-	readToIndex := 0
+// Reader parses consecutive requests from a single stream, keeping any bytes
+// read past the end of one request for the next.
+type Reader struct {
+	reader io.Reader
+	buf []byte
+	readToIndex int
+	limits Limits
+}
 
-	r := &Request{state: requestStateInitialized}
+func NewReader(reader io.Reader) *Reader {
+	return NewReaderWithLimits(reader, Limits{})
+}
 
-	for r.state != requestStateDone {
-		if readToIndex == len(buf) {
-			newBuf := make([]byte, len(buf) * 2)
-			copy(newBuf, buf)
-			buf = newBuf
-		}
+func NewReaderWithLimits(reader io.Reader, limits Limits) *Reader {
+	return &Reader{
+		reader: reader,
+		buf: make([]byte, bufferSize),
+		limits: limits,
+	}
+}
 
-		n, err := reader.Read(buf[readToIndex:])
+func RequestFromReader(reader io.Reader) (*Request, error) {
+	return NewReader(reader).ReadRequest()
+}
+
+// ReadRequest returns as soon as the headers are parsed; the body has to be
+// read or drained before the next request can be read. It returns io.EOF if
+// the stream ends cleanly before a new request starts.
+func (rr *Reader) ReadRequest() (*Request, error) {
+	r := &Request{
+		state: requestStateInitialized,
+		limits: rr.limits,
+	}
+
+	for r.state == requestStateInitialized || r.state == requestStateParsingHeaders {
+		parsed, err := r.parse(rr.buffered())
 		if err != nil {
-			if err == io.EOF {
-				break
-			}
 			return nil, err
 		}
-		readToIndex += n
+		rr.consume(parsed)
+		if parsed > 0 {
+			continue
+		}
 
-		parsed, err := r.parse(buf[:readToIndex])
+		err = rr.fill()
+		if err == io.EOF {
+			if r.state == requestStateInitialized && rr.readToIndex == 0 {
+				return nil, io.EOF
+			}
+			return nil, newError(ErrIncompleteRequest, "parser did not reach done state")
+		}
 		if err != nil {
 			return nil, err
 		}
+	}
 
-		if parsed > 0 {
-			copy(buf, buf[parsed:readToIndex])
-			readToIndex -= parsed
+	if err := r.startBody(rr); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Buffered returns the number of bytes already read past the previous
+// request.
+func (rr *Reader) Buffered() int {
+	return rr.readToIndex
+}
+
+// Detach returns the bytes read from the stream but not parsed yet and
+// empties the buffer. It is used when the stream is handed over to another
+// protocol after a request; the Reader must not be used afterwards.
+func (rr *Reader) Detach() []byte {
+	data := append([]byte(nil), rr.buffered()...)
+	rr.readToIndex = 0
+	return data
+}
+
+// Peek blocks until more of the stream arrives and keeps it for the next
+// ReadRequest. It lets a server notice a client hanging up while a handler
+// is still busy with a request whose body has been read in full.
+func (rr *Reader) Peek() error {
+	for n := rr.readToIndex; rr.readToIndex == n; {
+		if err := rr.fill(); err != nil {
+			return err
 		}
 	}
+	return nil
+}
+
+func (rr *Reader) buffered() []byte {
+	return rr.buf[:rr.readToIndex]
+}
+
+func (rr *Reader) consume(n int) {
+	if n > 0 {
+		copy(rr.buf, rr.buf[n:rr.readToIndex])
+		rr.readToIndex -= n
+	}
+}
 
-	if r.state != requestStateDone {
-		return nil, fmt.Errorf("incomplete request: parser did not reach done state")
+// fill reads more data into the buffer, growing it when it is full.
+func (rr *Reader) fill() error {
+	if rr.readToIndex == len(rr.buf) {
+		newBuf := make([]byte, len(rr.buf) * 2)
+		copy(newBuf, rr.buf)
+		rr.buf = newBuf
 	}
 
-	return r, nil
+	n, err := rr.reader.Read(rr.buf[rr.readToIndex:])
+	rr.readToIndex += n
+	if err == io.EOF && n > 0 {
+		return nil
+	}
+	return err
+}
+
+// readData copies buffered bytes into p, or reads straight from the stream
+// when nothing is buffered so large bodies skip the parse buffer.
+func (rr *Reader) readData(p []byte) (int, error) {
+	if rr.readToIndex > 0 {
+		n := copy(p, rr.buffered())
+		rr.consume(n)
+		return n, nil
+	}
+	n, err := rr.reader.Read(p)
+	if err == io.EOF {
+		if n > 0 {
+			return n, nil
+		}
+		return 0, io.ErrUnexpectedEOF
+	}
+	return n, err
 }
 
 func parseRequestLine(data []byte) (*RequestLine, int, error) {
@@ -81,6 +195,9 @@ func parseRequestLine(data []byte) (*RequestLine, int, error) {
 		return nil, 0, nil
 	}
 	requestLineText := string(data[:idx])
+	if strings.ContainsAny(requestLineText, "\r\n\x00") {
+		return nil, 0, newError(ErrMalformedRequestLine, "bare CR or LF")
+	}
 	requestLine, err := requestLineFromString(requestLineText)
 	if err != nil {
 		return nil, 0, err
@@ -91,13 +208,13 @@ func parseRequestLine(data []byte) (*RequestLine, int, error) {
 func requestLineFromString(str string) (*RequestLine, error) {
 	parts := strings.Split(str, " ")
 	if len(parts) != 3 {
-		return nil, fmt.Errorf("malformed request line: expected 3 parts, got %d", len(parts))
+		return nil, newError(ErrMalformedRequestLine, fmt.Sprintf("expected 3 parts, got %d", len(parts)))
 	}
 
 	method := parts[0]
 	for _, char := range method {
 		if char < 'A' || char > 'Z' {
-			return nil, fmt.Errorf("invalid method: %s", method)
+			return nil, newError(ErrInvalidMethod, method)
 		}
 	}
 
@@ -105,16 +222,19 @@ func requestLineFromString(str string) (*RequestLine, error) {
 
 	versionParts := strings.Split(parts[2], "/")
 	if len(versionParts) != 2{
-		return nil, fmt.Errorf("malformed start-line: %s", str)
+		return nil, newError(ErrMalformedRequestLine, str)
 	}
 
 	httpPart := versionParts[0]
 	if httpPart != "HTTP" {
-		return nil, fmt.Errorf("unrecognized HTTP-version: %s", httpPart)
+		return nil, newError(ErrMalformedRequestLine, "unrecognized HTTP-version: " + httpPart)
 	}
 	version := versionParts[1]
-	if version != "1.1" {
-		return nil, fmt.Errorf("unrecgnized HTTP-version: %s", version)
+	if version != "1.1" && version != "1.0" {
+		if isVersionNumber(version) {
+			return nil, newError(ErrUnsupportedVersion, version)
+		}
+		return nil, newError(ErrMalformedRequestLine, "unrecognized HTTP-version: " + version)
 	}
 
 	return &RequestLine{
@@ -128,11 +248,12 @@ func (r *Request) parse(data []byte) (int, error) {
 	totalParsed := 0
 
 	for r.state != requestStateDone {
+		prevState := r.state
 		n, err := r.parseSingle(data[totalParsed:])
 		if err != nil {
 			return 0, err
 		}
-		if n == 0 {
+		if n == 0 && r.state == prevState {
 			break
 		}
 		totalParsed += n
@@ -149,10 +270,22 @@ func (r *Request) parseSingle(data []byte) (int, error) {
 			return 0, err
 		}
 		if n == 0 {
+			if len(data) > r.limits.maxRequestLineBytes() {
+				return 0, newError(ErrRequestLineTooLong, "")
+			}
 			return 0, nil
 		}
+		if n - len(crlf) > r.limits.maxRequestLineBytes() {
+			return 0, newError(ErrRequestLineTooLong, "")
+		}
+
+		target, err := parseTarget(reqLine.Method, reqLine.RequestTarget)
+		if err != nil {
+			return 0, err
+		}
 
 		r.RequestLine = *reqLine
+		r.URL = target
 		r.Headers = make(headers.Headers)
 		r.state = requestStateParsingHeaders
 		return n, nil
@@ -160,34 +293,77 @@ func (r *Request) parseSingle(data []byte) (int, error) {
 	case requestStateParsingHeaders:
 		n, done, err := r.Headers.Parse(data)
 		if err != nil {
-			return 0, nil
+			return 0, &Error{StatusCode: 400, Err: err}
+		}
+		if err := r.checkHeaderLimits(n, done, len(data)); err != nil {
+			return 0, err
 		}
 		if done {
 			r.state = requestStateParsingBody
 		}
 		return n, nil
 		
-	case requestStateParsingBody:
-		clStr := r.Headers.Get("Content-Length")
-		if clStr == "" {
-			r.state = requestStateDone
+	case requestStateParsingBody, requestStateParsingChunkData:
+		// Body data is handed out by the body reader, not parsed here.
+		return 0, nil
+
+	case requestStateParsingChunkSize:
+		idx := bytes.Index(data, []byte(crlf))
+		if idx == -1 {
+			if len(data) > maxChunkSizeLineBytes {
+				return 0, newError(ErrMalformedChunk, "chunk size line too long")
+			}
 			return 0, nil
 		}
-
-		contentLen, err := strconv.Atoi(clStr)
+		size, err := parseChunkSize(data[:idx])
 		if err != nil {
-			return 0, fmt.Errorf("invalid Content-Length: %s", clStr)
+			return 0, err
+		}
+		if r.limits.bodyTooLarge(r.bodyRead + size) {
+			return 0, newError(ErrBodyTooLarge, "")
 		}
+		if size == 0 {
+			r.state = requestStateParsingTrailers
+		} else {
+			r.bodyRemaining = size
+			r.state = requestStateParsingChunkData
+		}
+		return idx + len(crlf), nil
 
-		r.Body = append(r.Body, data...)
-		if len(r.Body) > contentLen {
-			return 0, fmt.Errorf("body length exceeds Content-Length")
+	case requestStateParsingChunkDataEnd:
+		if len(data) < len(crlf) {
+			return 0, nil
 		}
-		if len(r.Body) == contentLen {
-			r.state = requestStateDone
+		if !bytes.HasPrefix(data, []byte(crlf)) {
+			return 0, newError(ErrMalformedChunk, "missing CRLF after chunk data")
 		}
+		r.state = requestStateParsingChunkSize
+		return len(crlf), nil
 
-		return len(data), nil
+	case requestStateParsingTrailers:
+		field := headers.NewHeaders()
+		n, done, err := field.Parse(data)
+		if err != nil {
+			return 0, &Error{StatusCode: 400, Err: err}
+		}
+		if err := r.checkHeaderLimits(n, done, len(data)); err != nil {
+			return 0, err
+		}
+		if done {
+			r.state = requestStateDone
+			return n, nil
+		}
+		for key, values := range field {
+			if headers.IsForbiddenTrailer(key) {
+				return 0, newError(ErrForbiddenTrailer, key)
+			}
+			if r.isDeclaredTrailer(key) {
+				for _, value := range values {
+					r.Trailers.Add(key, value)
+				}
+			}
+		}
+		return n, nil
 
 	case requestStateDone:
 		return 0, fmt.Errorf("error: tyring to read data in a done state")
@@ -195,4 +371,128 @@ func (r *Request) parseSingle(data []byte) (int, error) {
 	default:
 		return 0, fmt.Errorf("error: unknown state %d", r.state)
 	}
-}
\ No newline at end of file
+}
+
+// checkHeaderLimits accounts for one call to Headers.Parse that consumed n of
+// the buffered bytes, covering both the header and the trailer section.
+func (r *Request) checkHeaderLimits(n int, done bool, buffered int) error {
+	if n == 0 {
+		if r.headerBytes + buffered > r.limits.maxHeaderBytes() {
+			return newError(ErrHeaderTooLarge, "")
+		}
+		return nil
+	}
+	r.headerBytes += n
+	if r.headerBytes > r.limits.maxHeaderBytes() {
+		return newError(ErrHeaderTooLarge, "")
+	}
+	if !done {
+		r.headerCount++
+		if r.headerCount > r.limits.maxHeaderCount() {
+			return newError(ErrHeaderTooLarge, "")
+		}
+	}
+	return nil
+}
+
+// Context returns the request's context, which the server cancels when the
+// client disconnects, the server shuts down or the handler times out.
+func (r *Request) Context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
+}
+
+// WithContext returns a shallow copy of r using ctx, for middleware that
+// wants to attach values or deadlines for the handlers downstream.
+func (r *Request) WithContext(ctx context.Context) *Request {
+	r2 := *r
+	r2.ctx = ctx
+	return &r2
+}
+
+// BodyDone returns a channel that is closed once Body has been read to its
+// end, after which the request no longer uses the connection.
+func (r *Request) BodyDone() <-chan struct{} {
+	return r.bodyDone
+}
+
+// PathValue returns the value a router matched for the named path parameter,
+// or "" if there is none.
+func (r *Request) PathValue(name string) string {
+	return r.pathValues[name]
+}
+
+func (r *Request) SetPathValue(name, value string) {
+	if r.pathValues == nil {
+		r.pathValues = make(map[string]string)
+	}
+	r.pathValues[name] = value
+}
+
+// KeepAlive reports whether the client expects the connection to stay open
+// after the response: HTTP/1.1 connections persist unless the client sends
+// Connection: close, HTTP/1.0 ones only when it asks for keep-alive.
+func (r *Request) KeepAlive() bool {
+	if r.Headers.HasToken("Connection", "close") {
+		return false
+	}
+	if r.RequestLine.HttpVersion == "1.0" {
+		return r.Headers.HasToken("Connection", "keep-alive")
+	}
+	return true
+}
+
+// Only fields announced in the Trailer header are kept; when the client
+// declares nothing every allowed field is accepted.
+func (r *Request) isDeclaredTrailer(key string) bool {
+	declared := r.Headers.Get("Trailer")
+	if declared == "" {
+		return true
+	}
+	for _, name := range strings.Split(declared, ",") {
+		if strings.EqualFold(strings.TrimSpace(name), key) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseChunkSize(line []byte) (int64, error) {
+	if bytes.ContainsAny(line, "\r\n\x00") {
+		return 0, newError(ErrMalformedChunk, "bare CR or LF in chunk size line")
+	}
+	sizeStr := string(line)
+	if idx := strings.IndexByte(sizeStr, ';'); idx != -1 {
+		sizeStr = sizeStr[:idx]
+	}
+	sizeStr = strings.TrimRight(sizeStr, " \t")
+	if sizeStr == "" {
+		return 0, newError(ErrMalformedChunk, fmt.Sprintf("empty chunk size in %q", line))
+	}
+	for i := 0; i < len(sizeStr); i++ {
+		if !isHexDigit(sizeStr[i]) {
+			return 0, newError(ErrMalformedChunk, fmt.Sprintf("invalid chunk size %q", sizeStr))
+		}
+	}
+	size, err := strconv.ParseInt(sizeStr, 16, 64)
+	if err != nil {
+		return 0, newError(ErrMalformedChunk, fmt.Sprintf("chunk size too large %q", sizeStr))
+	}
+	return size, nil
+}
+
+// isVersionNumber reports whether version has the DIGIT "." DIGIT form of an
+// HTTP version, as opposed to garbage in the version slot.
+func isVersionNumber(version string) bool {
+	return len(version) == 3 && isDigit(version[0]) && version[1] == '.' && isDigit(version[2])
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isHexDigit(c byte) bool {
+	return ('0' <= c && c <= '9') || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
@@ -1,7 +1,10 @@
 package request
 
 import (
+	"context"
+	"httpfromtcp/internal/headers"
 	"io"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -33,6 +36,13 @@ func (cr *chunkReader) Read(p []byte) (n int, err error) {
 	return n, nil
 }
 
+func readBody(t *testing.T, r *Request) string {
+	t.Helper()
+	data, err := io.ReadAll(r.Body)
+	require.NoError(t, err)
+	return string(data)
+}
+
 func TestRequestLineParse(t *testing.T) {
 	// Test: Good GET Request line
 	reader := &chunkReader{
@@ -70,6 +80,15 @@ func TestRequestLineParse(t *testing.T) {
 	assert.Equal(t, "/coffee", r.RequestLine.RequestTarget)
 	assert.Equal(t, "1.1", r.RequestLine.HttpVersion)
 
+	// Test: Any valid method is accepted; routing decides what to serve
+	reader = &chunkReader{
+		data:            "TRACE / HTTP/1.1\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 5,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "TRACE", r.RequestLine.Method)
+
 	// Test: Invalid number of parts in request line
 	reader = &chunkReader{
 		data:            "/coffee HTTP/1.1\r\nHost: localhost:42069\r\nUser-Agent: curl/7.81.0\r\nAccept: */*\r\n\r\n",
@@ -112,9 +131,9 @@ func TestRequestHeaderParsing(t *testing.T) {
 	r, err := RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "localhost:42069", r.Headers["host"])
-	assert.Equal(t, "curl/7.81.0", r.Headers["user-agent"])
-	assert.Equal(t, "*/*", r.Headers["accept"])
+	assert.Equal(t, "localhost:42069", r.Headers.Get("host"))
+	assert.Equal(t, "curl/7.81.0", r.Headers.Get("user-agent"))
+	assert.Equal(t, "*/*", r.Headers.Get("accept"))
 
 	// Test: Malformed Header
 	reader = &chunkReader{
@@ -146,9 +165,9 @@ func TestRequestHeaderParsing(t *testing.T) {
 	r, err = RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "localhost:42069", r.Headers["host"])
-	assert.Equal(t, "curl/7.81.0", r.Headers["user-agent"])
-	assert.Equal(t, "*/*, text/html", r.Headers["accept"])
+	assert.Equal(t, "localhost:42069", r.Headers.Get("host"))
+	assert.Equal(t, "curl/7.81.0", r.Headers.Get("user-agent"))
+	assert.Equal(t, "*/*, text/html", r.Headers.Get("accept"))
 
 	// Test: Case Insensitive Headers
 	reader = &chunkReader{
@@ -159,7 +178,7 @@ func TestRequestHeaderParsing(t *testing.T) {
 	require.NoError(t, err)
 	require.NotNil(t, r)
 	assert.Contains(t, r.Headers, "host")
-	assert.Equal(t, "LOCALHOST, 42069", r.Headers["host"])
+	assert.Equal(t, "LOCALHOST, 42069", r.Headers.Get("host"))
 
 	// Test: Missing End of Headers
 	reader = &chunkReader{
@@ -184,7 +203,7 @@ func TestRequestBodyParsing(t *testing.T) {
 	r, err := RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "hello world!\n", string(r.Body))
+	assert.Equal(t, "hello world!\n", readBody(t, r))
 
 	// Test: Body shorter than reported content length
 	reader = &chunkReader{
@@ -196,8 +215,9 @@ func TestRequestBodyParsing(t *testing.T) {
 		numBytesPerRead: 3,
 	}
 	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	_, err = io.ReadAll(r.Body)
 	require.Error(t, err)
-	require.Nil(t, r)
 
 	// Test: Empty Body, 0 reported content length
 	reader = &chunkReader{
@@ -211,8 +231,7 @@ func TestRequestBodyParsing(t *testing.T) {
 	r, err = RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "", string(r.Body))
-	assert.Len(t, r.Body, 0)
+	assert.Equal(t, "", readBody(t, r))
 
 	// Test: Empty Body, no reported content length
 	reader = &chunkReader{
@@ -225,8 +244,7 @@ func TestRequestBodyParsing(t *testing.T) {
 	r, err = RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "", string(r.Body))
-	assert.Len(t, r.Body, 0)
+	assert.Equal(t, "", readBody(t, r))
 
 	// Test: No Content-Length but Body exists
 		reader = &chunkReader{
@@ -239,6 +257,572 @@ func TestRequestBodyParsing(t *testing.T) {
 	r, err = RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "", string(r.Body))
-	assert.Len(t, r.Body, 0)
-}
\ No newline at end of file
+	assert.Equal(t, "", readBody(t, r))
+}
+
+func TestRequestChunkedBodyParsing(t *testing.T) {
+	// Test: Standard chunked body
+	reader := &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"5\r\nhello\r\n" +
+			"7\r\n world!\r\n" +
+			"0\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "hello world!", readBody(t, r))
+
+	// Test: Chunk extensions and uppercase hex sizes
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"A;name=value\r\n0123456789\r\n" +
+			"1 ; foo\r\n!\r\n" +
+			"0\r\n" +
+			"\r\n",
+		numBytesPerRead: 1,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "0123456789!", readBody(t, r))
+
+	// Test: Chunked body together with Content-Length is rejected
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"Content-Length: 100\r\n" +
+			"\r\n" +
+			"3\r\nabc\r\n" +
+			"0\r\n" +
+			"\r\n",
+		numBytesPerRead: 64,
+	}
+	_, err = RequestFromReader(reader)
+	require.ErrorIs(t, err, ErrAmbiguousLength)
+
+	// Test: Empty chunked body
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"0\r\n" +
+			"\r\n",
+		numBytesPerRead: 5,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "", readBody(t, r))
+
+	// Test: Invalid chunk size
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"zz\r\nhello\r\n" +
+			"0\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	_, err = io.ReadAll(r.Body)
+	require.Error(t, err)
+
+	// Test: Chunk data longer than chunk size
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"3\r\nhello\r\n" +
+			"0\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	_, err = io.ReadAll(r.Body)
+	require.Error(t, err)
+
+	// Test: Missing terminating chunk
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"5\r\nhello\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	_, err = io.ReadAll(r.Body)
+	require.Error(t, err)
+}
+
+func TestRequestTrailerParsing(t *testing.T) {
+	// Test: Declared trailers
+	reader := &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"Trailer: X-Checksum, X-Count\r\n" +
+			"\r\n" +
+			"5\r\nhello\r\n" +
+			"0\r\n" +
+			"X-Checksum: abc123\r\n" +
+			"X-Count: 5\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "hello", readBody(t, r))
+	assert.Equal(t, "abc123", r.Trailers.Get("X-Checksum"))
+	assert.Equal(t, "5", r.Trailers.Get("X-Count"))
+
+	// Test: Undeclared trailers are dropped
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"Trailer: X-Checksum\r\n" +
+			"\r\n" +
+			"0\r\n" +
+			"X-Checksum: abc123\r\n" +
+			"X-Sneaky: yes\r\n" +
+			"\r\n",
+		numBytesPerRead: 4,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "", readBody(t, r))
+	assert.Equal(t, "abc123", r.Trailers.Get("X-Checksum"))
+	assert.NotContains(t, r.Trailers, "x-sneaky")
+
+	// Test: No Trailer declaration accepts any allowed field
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"0\r\n" +
+			"X-Checksum: abc123\r\n" +
+			"\r\n",
+		numBytesPerRead: 2,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "", readBody(t, r))
+	assert.Equal(t, "abc123", r.Trailers.Get("X-Checksum"))
+
+	// Test: Forbidden trailer field
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"5\r\nhello\r\n" +
+			"0\r\n" +
+			"Content-Length: 5\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	_, err = io.ReadAll(r.Body)
+	require.Error(t, err)
+
+	// Test: Forbidden trailer field even when declared
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"Trailer: Host\r\n" +
+			"\r\n" +
+			"0\r\n" +
+			"Host: evil.example\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	_, err = io.ReadAll(r.Body)
+	require.Error(t, err)
+}
+
+func TestReaderMultipleRequests(t *testing.T) {
+	// Test: Consecutive requests on one stream keep leftover bytes
+	reader := &chunkReader{
+		data: "POST /first HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Content-Length: 5\r\n" +
+			"\r\n" +
+			"hello" +
+			"GET /second HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"\r\n" +
+			"POST /third HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"3\r\nabc\r\n" +
+			"0\r\n" +
+			"\r\n",
+		numBytesPerRead: 7,
+	}
+	rr := NewReader(reader)
+
+	r, err := rr.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/first", r.RequestLine.RequestTarget)
+	assert.Equal(t, "hello", readBody(t, r))
+
+	r, err = rr.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/second", r.RequestLine.RequestTarget)
+	assert.Equal(t, "", readBody(t, r))
+
+	r, err = rr.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/third", r.RequestLine.RequestTarget)
+	assert.Equal(t, "abc", readBody(t, r))
+
+	_, err = rr.ReadRequest()
+	assert.Equal(t, io.EOF, err)
+
+	// Test: Whole pipeline delivered in a single read
+	reader = &chunkReader{
+		data: "GET /a HTTP/1.1\r\n\r\nGET /b HTTP/1.1\r\n\r\n",
+		numBytesPerRead: 1024,
+	}
+	rr = NewReader(reader)
+	r, err = rr.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/a", r.RequestLine.RequestTarget)
+	r, err = rr.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/b", r.RequestLine.RequestTarget)
+
+	// Test: Stream ends in the middle of a second request
+	reader = &chunkReader{
+		data: "GET /a HTTP/1.1\r\n\r\nGET /b HTT",
+		numBytesPerRead: 4,
+	}
+	rr = NewReader(reader)
+	_, err = rr.ReadRequest()
+	require.NoError(t, err)
+	_, err = rr.ReadRequest()
+	require.Error(t, err)
+	assert.NotEqual(t, io.EOF, err)
+}
+
+func TestRequestStreamingBody(t *testing.T) {
+	// Test: Headers are returned before the body arrives
+	pr, pw := io.Pipe()
+	go func() {
+		pw.Write([]byte("POST /upload HTTP/1.1\r\nContent-Length: 11\r\n\r\n"))
+		pw.Write([]byte("hello"))
+		pw.Write([]byte(" world"))
+		pw.Close()
+	}()
+	r, err := RequestFromReader(pr)
+	require.NoError(t, err)
+	assert.Equal(t, int64(11), r.ContentLength)
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(r.Body, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(buf))
+	assert.Equal(t, " world", readBody(t, r))
+
+	// Test: Unread bodies are drained before the next request
+	reader := &chunkReader{
+		data: "POST /first HTTP/1.1\r\n" +
+			"Content-Length: 5\r\n" +
+			"\r\n" +
+			"hello" +
+			"POST /second HTTP/1.1\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"3\r\nabc\r\n" +
+			"0\r\n" +
+			"\r\n" +
+			"GET /third HTTP/1.1\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+	rr := NewReader(reader)
+	r, err = rr.ReadRequest()
+	require.NoError(t, err)
+	require.NoError(t, r.Body.Close())
+	assert.True(t, r.DrainBody(1024))
+
+	r, err = rr.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/second", r.RequestLine.RequestTarget)
+	assert.Equal(t, int64(-1), r.ContentLength)
+	assert.True(t, r.DrainBody(1024))
+
+	r, err = rr.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/third", r.RequestLine.RequestTarget)
+	assert.Equal(t, int64(0), r.ContentLength)
+
+	// Test: Bodies larger than the drain limit are not drained
+	reader = &chunkReader{
+		data: "POST /big HTTP/1.1\r\n" +
+			"Content-Length: 10\r\n" +
+			"\r\n" +
+			"0123456789",
+		numBytesPerRead: 4,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.False(t, r.DrainBody(5))
+
+	// Test: BodyDone is closed once the body is read to its end, and Peek
+	// keeps what follows for the next request
+	reader = &chunkReader{
+		data: "POST /first HTTP/1.1\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"3\r\nabc\r\n" +
+			"0\r\n" +
+			"\r\n" +
+			"GET /second HTTP/1.1\r\n" +
+			"\r\n",
+		numBytesPerRead: 4,
+	}
+	rr = NewReader(reader)
+	r, err = rr.ReadRequest()
+	require.NoError(t, err)
+	select {
+	case <-r.BodyDone():
+		t.Fatal("BodyDone closed before the body was read")
+	default:
+	}
+	assert.Equal(t, "abc", readBody(t, r))
+	<-r.BodyDone()
+	for rr.Buffered() < len("GET /second HTTP/1.1\r\n\r\n") {
+		require.NoError(t, rr.Peek())
+	}
+	assert.Equal(t, io.EOF, rr.Peek())
+	r, err = rr.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/second", r.RequestLine.RequestTarget)
+	<-r.BodyDone()
+}
+
+func TestRequestLimits(t *testing.T) {
+	// Test: Request line too long
+	reader := &chunkReader{
+		data:            "GET /" + strings.Repeat("a", 64) + " HTTP/1.1\r\n\r\n",
+		numBytesPerRead: 8,
+	}
+	_, err := NewReaderWithLimits(reader, Limits{MaxRequestLineBytes: 32}).ReadRequest()
+	require.ErrorIs(t, err, ErrRequestLineTooLong)
+
+	// Test: Endless request line without CRLF
+	reader = &chunkReader{
+		data:            "GET /" + strings.Repeat("a", 1024),
+		numBytesPerRead: 16,
+	}
+	_, err = NewReaderWithLimits(reader, Limits{MaxRequestLineBytes: 32}).ReadRequest()
+	require.ErrorIs(t, err, ErrRequestLineTooLong)
+
+	// Test: Header line longer than the header limit
+	reader = &chunkReader{
+		data:            "GET / HTTP/1.1\r\nX-Big: " + strings.Repeat("a", 1024),
+		numBytesPerRead: 16,
+	}
+	_, err = NewReaderWithLimits(reader, Limits{MaxHeaderBytes: 256}).ReadRequest()
+	require.ErrorIs(t, err, ErrHeaderTooLarge)
+
+	// Test: Too many header fields
+	reader = &chunkReader{
+		data:            "GET / HTTP/1.1\r\nA: 1\r\nB: 2\r\nC: 3\r\n\r\n",
+		numBytesPerRead: 5,
+	}
+	_, err = NewReaderWithLimits(reader, Limits{MaxHeaderCount: 2}).ReadRequest()
+	require.ErrorIs(t, err, ErrHeaderTooLarge)
+
+	// Test: Header count at the limit
+	reader = &chunkReader{
+		data:            "GET / HTTP/1.1\r\nA: 1\r\nB: 2\r\n\r\n",
+		numBytesPerRead: 5,
+	}
+	_, err = NewReaderWithLimits(reader, Limits{MaxHeaderCount: 2}).ReadRequest()
+	require.NoError(t, err)
+
+	// Test: Content-Length over the body limit
+	reader = &chunkReader{
+		data:            "POST / HTTP/1.1\r\nContent-Length: 11\r\n\r\nhello world",
+		numBytesPerRead: 5,
+	}
+	_, err = NewReaderWithLimits(reader, Limits{MaxBodyBytes: 10}).ReadRequest()
+	require.ErrorIs(t, err, ErrBodyTooLarge)
+
+	// Test: Chunked body over the body limit
+	reader = &chunkReader{
+		data: "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n" +
+			"6\r\nhello \r\n" +
+			"5\r\nworld\r\n" +
+			"0\r\n\r\n",
+		numBytesPerRead: 5,
+	}
+	r, err := NewReaderWithLimits(reader, Limits{MaxBodyBytes: 10}).ReadRequest()
+	require.NoError(t, err)
+	_, err = io.ReadAll(r.Body)
+	require.ErrorIs(t, err, ErrBodyTooLarge)
+
+	// Test: Body at the limit
+	reader = &chunkReader{
+		data:            "POST / HTTP/1.1\r\nContent-Length: 10\r\n\r\n0123456789",
+		numBytesPerRead: 5,
+	}
+	r, err = NewReaderWithLimits(reader, Limits{MaxBodyBytes: 10}).ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "0123456789", readBody(t, r))
+}
+
+func TestRequestErrorStatusCodes(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		target error
+		status int
+	}{
+		{"missing version", "GET /\r\n\r\n", ErrMalformedRequestLine, 400},
+		{"lower case method", "get / HTTP/1.1\r\n\r\n", ErrInvalidMethod, 400},
+		{"unsupported version", "GET / HTTP/2.0\r\n\r\n", ErrUnsupportedVersion, 505},
+		{"garbage version", "GET / HTTP/one\r\n\r\n", ErrMalformedRequestLine, 400},
+		{"invalid header name", "GET / HTTP/1.1\r\nH@st: x\r\n\r\n", headers.ErrInvalidFieldName, 400},
+		{"header without colon", "GET / HTTP/1.1\r\nHost x\r\n\r\n", headers.ErrMalformedFieldLine, 400},
+		{"bad content length", "POST / HTTP/1.1\r\nContent-Length: ten\r\n\r\n", ErrInvalidContentLength, 400},
+		{"negative content length", "POST / HTTP/1.1\r\nContent-Length: -1\r\n\r\n", ErrInvalidContentLength, 400},
+		{"empty content length", "POST / HTTP/1.1\r\nContent-Length:\r\n\r\n", ErrLengthRequired, 411},
+		{"unknown transfer coding", "POST / HTTP/1.1\r\nTransfer-Encoding: br\r\n\r\n", ErrUnsupportedTransferCoding, 501},
+		{"incomplete request", "GET / HTTP/1.1\r\nHost: x\r\n", ErrIncompleteRequest, 400},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := &chunkReader{data: tt.data, numBytesPerRead: 4}
+			_, err := RequestFromReader(reader)
+			require.ErrorIs(t, err, tt.target)
+			assert.Equal(t, tt.status, StatusCode(err))
+		})
+	}
+
+	// Test: Body errors carry a status code too
+	reader := &chunkReader{
+		data:            "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\nxyz\r\n",
+		numBytesPerRead: 4,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	_, err = io.ReadAll(r.Body)
+	require.ErrorIs(t, err, ErrMalformedChunk)
+	assert.Equal(t, 400, StatusCode(err))
+
+	// Test: Errors from the underlying reader default to 400
+	assert.Equal(t, 400, StatusCode(io.ErrUnexpectedEOF))
+}
+
+func TestRequestHTTP10(t *testing.T) {
+	// Test: HTTP/1.0 request line
+	reader := &chunkReader{
+		data:            "GET / HTTP/1.0\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "1.0", r.RequestLine.HttpVersion)
+	assert.False(t, r.KeepAlive())
+
+	// Test: HTTP/1.0 keep-alive
+	reader = &chunkReader{
+		data:            "GET / HTTP/1.0\r\nConnection: Keep-Alive\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.True(t, r.KeepAlive())
+
+	// Test: HTTP/1.1 persists unless closed
+	reader = &chunkReader{
+		data:            "GET / HTTP/1.1\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.True(t, r.KeepAlive())
+
+	reader = &chunkReader{
+		data:            "GET / HTTP/1.1\r\nConnection: close\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.False(t, r.KeepAlive())
+
+	// Test: HTTP/1.0 body with Content-Length
+	reader = &chunkReader{
+		data:            "POST / HTTP/1.0\r\nContent-Length: 5\r\n\r\nhello",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", readBody(t, r))
+
+	// Test: HTTP/1.0 with Transfer-Encoding
+	reader = &chunkReader{
+		data:            "POST / HTTP/1.0\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err = RequestFromReader(reader)
+	require.ErrorIs(t, err, ErrLengthRequired)
+	assert.Equal(t, 411, StatusCode(err))
+}
+
+func TestRequestWithContext(t *testing.T) {
+	reader := &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"5\r\nhello\r\n" +
+			"0\r\n" +
+			"X-Checksum: abc123\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, context.Background(), r.Context())
+
+	type key struct{}
+	ctx := context.WithValue(context.Background(), key{}, "value")
+	r2 := r.WithContext(ctx)
+	assert.Equal(t, "value", r2.Context().Value(key{}))
+	assert.Nil(t, r.Context().Value(key{}))
+
+	// Test: Body and trailers are shared with the original
+	assert.Equal(t, "hello", readBody(t, r2))
+	assert.Equal(t, "abc123", r2.Trailers.Get("X-Checksum"))
+	assert.Equal(t, "abc123", r.Trailers.Get("X-Checksum"))
+}
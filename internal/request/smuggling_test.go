@@ -0,0 +1,121 @@
+package request
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readAll parses every request on a connection, reading each body, until the
+// input ends or a request is rejected.
+func readAll(data string) (targets []string, bodies []string, err error) {
+	rr := NewReader(&chunkReader{data: data, numBytesPerRead: 3})
+	for {
+		req, err := rr.ReadRequest()
+		if err == io.EOF {
+			return targets, bodies, nil
+		}
+		if err != nil {
+			return targets, bodies, err
+		}
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			return targets, bodies, err
+		}
+		targets = append(targets, req.RequestLine.RequestTarget)
+		bodies = append(bodies, string(body))
+	}
+}
+
+// Payloads known to make front-end and back-end parsers disagree about where
+// a request ends. Each must be rejected before anything after the ambiguous
+// framing is treated as a request.
+func TestRequestSmugglingCorpus(t *testing.T) {
+	const smuggled = "GET /admin HTTP/1.1\r\nHost: x\r\n\r\n"
+	tests := []struct {
+		name   string
+		data   string
+		status int
+	}{
+		{"CL.CL conflicting fields", "POST / HTTP/1.1\r\nHost: x\r\nContent-Length: 0\r\nContent-Length: 33\r\n\r\n" + smuggled, 400},
+		{"CL.CL conflicting list", "POST / HTTP/1.1\r\nHost: x\r\nContent-Length: 0, 33\r\n\r\n" + smuggled, 400},
+		{"CL signed", "POST / HTTP/1.1\r\nHost: x\r\nContent-Length: +33\r\n\r\n" + smuggled, 400},
+		{"CL hex", "POST / HTTP/1.1\r\nHost: x\r\nContent-Length: 0x21\r\n\r\n" + smuggled, 400},
+		{"CL negative", "POST / HTTP/1.1\r\nHost: x\r\nContent-Length: -1\r\n\r\n" + smuggled, 400},
+		{"CL.TE", "POST / HTTP/1.1\r\nHost: x\r\nContent-Length: 6\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n" + smuggled, 400},
+		{"TE.CL", "POST / HTTP/1.1\r\nHost: x\r\nTransfer-Encoding: chunked\r\nContent-Length: 4\r\n\r\n5c\r\n" + smuggled + "\r\n0\r\n\r\n", 400},
+		{"TE.TE unknown second field", "POST / HTTP/1.1\r\nHost: x\r\nTransfer-Encoding: chunked\r\nTransfer-Encoding: cow\r\n\r\n0\r\n\r\n" + smuggled, 501},
+		{"TE misspelled", "POST / HTTP/1.1\r\nHost: x\r\nTransfer-Encoding: xchunked\r\n\r\n0\r\n\r\n" + smuggled, 501},
+		{"TE identity", "POST / HTTP/1.1\r\nHost: x\r\nTransfer-Encoding: chunked, identity\r\n\r\n0\r\n\r\n" + smuggled, 501},
+		{"TE trailing vertical tab", "POST / HTTP/1.1\r\nHost: x\r\nTransfer-Encoding: chunked\x0b\r\n\r\n0\r\n\r\n" + smuggled, 501},
+		{"TE chunked not final", "POST / HTTP/1.1\r\nHost: x\r\nTransfer-Encoding: chunked, gzip\r\n\r\n0\r\n\r\n" + smuggled, 400},
+		{"TE chunked twice", "POST / HTTP/1.1\r\nHost: x\r\nTransfer-Encoding: chunked, chunked\r\n\r\n0\r\n\r\n" + smuggled, 400},
+		{"TE gzip only", "POST / HTTP/1.1\r\nHost: x\r\nTransfer-Encoding: gzip\r\n\r\n" + smuggled, 400},
+		{"TE empty", "POST / HTTP/1.1\r\nHost: x\r\nTransfer-Encoding: \r\n\r\n" + smuggled, 400},
+		{"TE chunked twice after gzip", "POST / HTTP/1.1\r\nHost: x\r\nTransfer-Encoding: gzip, chunked, chunked\r\n\r\n0\r\n\r\n" + smuggled, 400},
+		{"TE gzip then chunked", "POST / HTTP/1.1\r\nHost: x\r\nTransfer-Encoding: gzip, chunked\r\n\r\n0\r\n\r\n" + smuggled, 501},
+		{"TE space before colon", "POST / HTTP/1.1\r\nHost: x\r\nTransfer-Encoding : chunked\r\n\r\n0\r\n\r\n" + smuggled, 400},
+		{"TE leading whitespace", "POST / HTTP/1.1\r\n Transfer-Encoding: chunked\r\nHost: x\r\n\r\n0\r\n\r\n" + smuggled, 400},
+		{"TE obs-fold", "POST / HTTP/1.1\r\nHost: x\r\nTransfer-Encoding: \r\n chunked\r\n\r\n0\r\n\r\n" + smuggled, 400},
+		{"TE in HTTP/1.0", "POST / HTTP/1.0\r\nHost: x\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n" + smuggled, 411},
+		{"bare LF in header section", "POST / HTTP/1.1\r\nHost: x\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n" + smuggled, 400},
+		{"bare CR in header section", "POST / HTTP/1.1\r\nHost: x\rContent-Length: 33\r\n\r\n" + smuggled, 400},
+		{"bare LF ending header section", "POST / HTTP/1.1\r\nHost: x\r\nContent-Length: 33\n\r\n" + smuggled, 400},
+		{"bare LF in request line", "GET / HTTP/1.1\nHost: x\r\n\r\n" + smuggled, 400},
+		{"NUL in header value", "POST / HTTP/1.1\r\nHost: x\x00\r\nContent-Length: 0\r\n\r\n" + smuggled, 400},
+		{"chunk size overflow", "POST / HTTP/1.1\r\nHost: x\r\nTransfer-Encoding: chunked\r\n\r\n10000000000000000\r\n" + smuggled, 400},
+		{"chunk size with prefix", "POST / HTTP/1.1\r\nHost: x\r\nTransfer-Encoding: chunked\r\n\r\n0x5\r\nhello\r\n0\r\n\r\n" + smuggled, 400},
+		{"chunk size bare LF", "POST / HTTP/1.1\r\nHost: x\r\nTransfer-Encoding: chunked\r\n\r\n5;ext\nhello\r\n0\r\n\r\n" + smuggled, 400},
+		{"chunk data overrun", "POST / HTTP/1.1\r\nHost: x\r\nTransfer-Encoding: chunked\r\n\r\n3\r\nhello\r\n0\r\n\r\n" + smuggled, 400},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			targets, _, err := readAll(tt.data)
+			require.Error(t, err)
+			assert.Equal(t, tt.status, StatusCode(err), err.Error())
+			assert.NotContains(t, targets, "/admin")
+		})
+	}
+}
+
+// Framing that looks unusual but is unambiguous keeps working.
+func TestRequestSmugglingAccepted(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		bodies []string
+	}{
+		{"CL repeated with same value", "POST / HTTP/1.1\r\nHost: x\r\nContent-Length: 5\r\nContent-Length: 5\r\n\r\nhello", []string{"hello"}},
+		{"CL list with same value", "POST / HTTP/1.1\r\nHost: x\r\nContent-Length: 5, 5\r\n\r\nhello", []string{"hello"}},
+		{"TE mixed case", "POST / HTTP/1.1\r\nHost: x\r\nTransfer-Encoding: Chunked\r\n\r\n5\r\nhello\r\n0\r\n\r\n", []string{"hello"}},
+		{"TE with empty list members", "POST / HTTP/1.1\r\nHost: x\r\nTransfer-Encoding: , chunked\r\n\r\n5\r\nhello\r\n0\r\n\r\n", []string{"hello"}},
+		{"pipelined after CL body", "POST / HTTP/1.1\r\nHost: x\r\nContent-Length: 5\r\n\r\nhelloGET /next HTTP/1.1\r\nHost: x\r\n\r\n", []string{"hello", ""}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, bodies, err := readAll(tt.data)
+			require.NoError(t, err)
+			assert.Equal(t, tt.bodies, bodies)
+		})
+	}
+}
+
+func TestParseContentLength(t *testing.T) {
+	n, err := parseContentLength([]string{" 42 ", "42"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), n)
+
+	_, err = parseContentLength([]string{"42", "43"})
+	assert.ErrorIs(t, err, ErrInvalidContentLength)
+
+	_, err = parseContentLength([]string{strings.Repeat("9", 20)})
+	assert.ErrorIs(t, err, ErrInvalidContentLength)
+
+	_, err = parseContentLength([]string{""})
+	assert.ErrorIs(t, err, ErrLengthRequired)
+}
@@ -0,0 +1,162 @@
+package request
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+type TargetForm int
+
+const (
+	OriginForm TargetForm = iota
+	AbsoluteForm
+	AuthorityForm
+	AsteriskForm
+)
+
+// URL is the parsed request target (RFC 9112 3.2).
+type URL struct {
+	Form TargetForm
+	// Scheme is only set for absolute-form targets, Host for absolute-form
+	// and authority-form ones.
+	Scheme string
+	Host   string
+	// Path is percent-decoded; RawPath is the path exactly as sent. Segments
+	// are decoded one by one, so an encoded slash stays inside its segment.
+	Path     string
+	RawPath  string
+	Segments []string
+	RawQuery string
+	Query    url.Values
+}
+
+func parseTarget(method, target string) (URL, error) {
+	for i := 0; i < len(target); i++ {
+		if target[i] <= ' ' || target[i] >= 0x7f || target[i] == '#' {
+			return URL{}, newError(ErrInvalidTarget, fmt.Sprintf("invalid character in %q", target))
+		}
+	}
+
+	switch {
+	case method == "CONNECT":
+		return parseAuthorityForm(target)
+	case target == "*":
+		if method != "OPTIONS" {
+			return URL{}, newError(ErrInvalidTarget, "asterisk-form is only allowed for OPTIONS")
+		}
+		return URL{Form: AsteriskForm, Query: url.Values{}}, nil
+	case strings.HasPrefix(target, "/"):
+		u := URL{Form: OriginForm}
+		if err := u.parsePathAndQuery(target); err != nil {
+			return URL{}, err
+		}
+		return u, nil
+	case strings.Contains(target, "://"):
+		return parseAbsoluteForm(target)
+	default:
+		return URL{}, newError(ErrInvalidTarget, target)
+	}
+}
+
+func parseAuthorityForm(target string) (URL, error) {
+	host, port, err := net.SplitHostPort(target)
+	if err != nil || host == "" || port == "" || strings.ContainsAny(target, "/?@") {
+		return URL{}, newError(ErrInvalidTarget, "CONNECT requires host:port, got "+target)
+	}
+	return URL{Form: AuthorityForm, Host: target, Query: url.Values{}}, nil
+}
+
+func parseAbsoluteForm(target string) (URL, error) {
+	scheme, rest, _ := strings.Cut(target, "://")
+	if !isValidScheme(scheme) {
+		return URL{}, newError(ErrInvalidTarget, "invalid scheme in "+target)
+	}
+
+	host := rest
+	pathAndQuery := "/"
+	if idx := strings.IndexAny(rest, "/?"); idx != -1 {
+		host = rest[:idx]
+		pathAndQuery = rest[idx:]
+		if strings.HasPrefix(pathAndQuery, "?") {
+			pathAndQuery = "/" + pathAndQuery
+		}
+	}
+	if host == "" || strings.Contains(host, "@") {
+		return URL{}, newError(ErrInvalidTarget, "invalid authority in "+target)
+	}
+
+	u := URL{Form: AbsoluteForm, Scheme: strings.ToLower(scheme), Host: host}
+	if err := u.parsePathAndQuery(pathAndQuery); err != nil {
+		return URL{}, err
+	}
+	return u, nil
+}
+
+func (u *URL) parsePathAndQuery(target string) error {
+	rawPath, rawQuery, _ := strings.Cut(target, "?")
+
+	path, err := url.PathUnescape(rawPath)
+	if err != nil {
+		return newError(ErrInvalidTarget, fmt.Sprintf("invalid percent-encoding in %q", rawPath))
+	}
+	var segments []string
+	if trimmed := strings.TrimPrefix(rawPath, "/"); trimmed != "" {
+		for _, raw := range strings.Split(trimmed, "/") {
+			segment, err := url.PathUnescape(raw)
+			if err != nil {
+				return newError(ErrInvalidTarget, fmt.Sprintf("invalid percent-encoding in %q", rawPath))
+			}
+			segments = append(segments, segment)
+		}
+	}
+	query, err := parseQuery(rawQuery)
+	if err != nil {
+		return err
+	}
+
+	u.Path = path
+	u.RawPath = rawPath
+	u.Segments = segments
+	u.RawQuery = rawQuery
+	u.Query = query
+	return nil
+}
+
+// parseQuery splits on '&' only; unlike url.ParseQuery it does not reject
+// semicolons, which some clients still send inside values.
+func parseQuery(rawQuery string) (url.Values, error) {
+	query := url.Values{}
+	for _, pair := range strings.Split(rawQuery, "&") {
+		if pair == "" {
+			continue
+		}
+		rawKey, rawValue, _ := strings.Cut(pair, "=")
+		key, err := url.QueryUnescape(rawKey)
+		if err != nil {
+			return nil, newError(ErrInvalidTarget, fmt.Sprintf("invalid percent-encoding in %q", pair))
+		}
+		value, err := url.QueryUnescape(rawValue)
+		if err != nil {
+			return nil, newError(ErrInvalidTarget, fmt.Sprintf("invalid percent-encoding in %q", pair))
+		}
+		query[key] = append(query[key], value)
+	}
+	return query, nil
+}
+
+func isValidScheme(scheme string) bool {
+	if scheme == "" {
+		return false
+	}
+	for i := 0; i < len(scheme); i++ {
+		c := scheme[i]
+		isLetter := ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+		if isLetter || (i > 0 && (isDigit(c) || c == '+' || c == '-' || c == '.')) {
+			continue
+		}
+		return false
+	}
+	return true
+}
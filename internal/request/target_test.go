@@ -0,0 +1,102 @@
+package request
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTarget(t *testing.T) {
+	// Test: Origin-form with query
+	u, err := parseTarget("GET", "/users/42/posts?sort=new&tag=go&tag=http&q=a+b%21")
+	require.NoError(t, err)
+	assert.Equal(t, OriginForm, u.Form)
+	assert.Equal(t, "/users/42/posts", u.Path)
+	assert.Equal(t, []string{"users", "42", "posts"}, u.Segments)
+	assert.Equal(t, "sort=new&tag=go&tag=http&q=a+b%21", u.RawQuery)
+	assert.Equal(t, "new", u.Query.Get("sort"))
+	assert.Equal(t, []string{"go", "http"}, u.Query["tag"])
+	assert.Equal(t, "a b!", u.Query.Get("q"))
+
+	// Test: Root path has no segments
+	u, err = parseTarget("GET", "/")
+	require.NoError(t, err)
+	assert.Equal(t, "/", u.Path)
+	assert.Empty(t, u.Segments)
+	assert.Empty(t, u.Query)
+
+	// Test: Percent-decoding keeps encoded slashes inside their segment
+	u, err = parseTarget("GET", "/files/a%2Fb/caf%C3%A9")
+	require.NoError(t, err)
+	assert.Equal(t, "/files/a/b/café", u.Path)
+	assert.Equal(t, "/files/a%2Fb/caf%C3%A9", u.RawPath)
+	assert.Equal(t, []string{"files", "a/b", "café"}, u.Segments)
+
+	// Test: Absolute-form
+	u, err = parseTarget("GET", "http://example.com:8080/index.html?x=1")
+	require.NoError(t, err)
+	assert.Equal(t, AbsoluteForm, u.Form)
+	assert.Equal(t, "http", u.Scheme)
+	assert.Equal(t, "example.com:8080", u.Host)
+	assert.Equal(t, "/index.html", u.Path)
+	assert.Equal(t, "1", u.Query.Get("x"))
+
+	// Test: Absolute-form without a path
+	u, err = parseTarget("GET", "http://example.com?x=1")
+	require.NoError(t, err)
+	assert.Equal(t, "/", u.Path)
+	assert.Equal(t, "1", u.Query.Get("x"))
+
+	// Test: Authority-form for CONNECT
+	u, err = parseTarget("CONNECT", "example.com:443")
+	require.NoError(t, err)
+	assert.Equal(t, AuthorityForm, u.Form)
+	assert.Equal(t, "example.com:443", u.Host)
+
+	// Test: Asterisk-form for OPTIONS
+	u, err = parseTarget("OPTIONS", "*")
+	require.NoError(t, err)
+	assert.Equal(t, AsteriskForm, u.Form)
+
+	// Test: Invalid targets
+	invalid := []struct {
+		method string
+		target string
+	}{
+		{"GET", "/bad%zzpath"},
+		{"GET", "/trailing%2"},
+		{"GET", "/?q=%G1"},
+		{"GET", "/page#fragment"},
+		{"GET", "*"},
+		{"GET", "relative/path"},
+		{"GET", "http://user@example.com/"},
+		{"GET", "1http://example.com/"},
+		{"CONNECT", "example.com"},
+		{"CONNECT", "/path"},
+	}
+	for _, tt := range invalid {
+		_, err := parseTarget(tt.method, tt.target)
+		require.ErrorIs(t, err, ErrInvalidTarget, "%s %s", tt.method, tt.target)
+		assert.Equal(t, 400, StatusCode(err))
+	}
+}
+
+func TestRequestURL(t *testing.T) {
+	reader := &chunkReader{
+		data:            "GET /search?q=tcp HTTP/1.1\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "/search?q=tcp", r.RequestLine.RequestTarget)
+	assert.Equal(t, "/search", r.URL.Path)
+	assert.Equal(t, "tcp", r.URL.Query.Get("q"))
+
+	reader = &chunkReader{
+		data:            "GET /bad%zz HTTP/1.1\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err = RequestFromReader(reader)
+	require.ErrorIs(t, err, ErrInvalidTarget)
+}
@@ -12,17 +12,25 @@ func GetDefaultHeaders(contentLen int) headers.Headers {
 
 	strContentLen := strconv.Itoa(contentLen)
 	h.Set("Content-Length", strContentLen)
-	h.Set("Connection", "close")
 	h.Set("Content-Type", "text/plain")
 
 	return h
 }
 
-func writeHeadersTo(w io.Writer, headers headers.Headers) error {
-	for key, value := range headers {
-		_, err := fmt.Fprintf(w, "%s: %s\r\n", key, value)
-		if err != nil {
-			return err
+// writeHeadersTo writes a header or trailer section in a fixed order with
+// canonically cased names, followed by the blank line ending it. Every value
+// goes out on its own field line. Nothing is written if any field is invalid.
+func writeHeadersTo(w io.Writer, h headers.Headers) error {
+	if err := h.Validate(); err != nil {
+		return err
+	}
+	for _, key := range h.Keys() {
+		name := headers.CanonicalName(key)
+		for _, value := range h[key] {
+			_, err := fmt.Fprintf(w, "%s: %s\r\n", name, value)
+			if err != nil {
+				return err
+			}
 		}
 	}
 	_, err := fmt.Fprintf(w, "\r\n")
@@ -0,0 +1,150 @@
+package response
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidEvent is returned for an event whose ID or name contains a line
+// break, which would end the field early.
+var ErrInvalidEvent = errors.New("event ID or name contains a line break")
+
+// Event is a single Server-Sent Event. Empty fields are left out.
+type Event struct {
+	ID    string
+	Event string
+	// Data may span several lines; each goes out as its own data field.
+	Data string
+	// Retry tells the browser how long to wait before reconnecting.
+	Retry time.Duration
+}
+
+// EventStream sends Server-Sent Events over a chunked response, flushing each
+// one to the client as soon as it is written.
+type EventStream struct {
+	w   *Writer
+	ctx context.Context
+}
+
+// NewEventStream starts a text/event-stream response on w. ctx should be the
+// request's context so that the stream notices when the client goes away.
+// The status line may already have been written, the headers not.
+func NewEventStream(ctx context.Context, w *Writer) (*EventStream, error) {
+	if w.state == statInit {
+		if err := w.WriteStatusLine(StatusOK); err != nil {
+			return nil, err
+		}
+	}
+	if w.state != stateStatusWritten {
+		return nil, fmt.Errorf("headers already written")
+	}
+	w.Header.Override("Content-Type", "text/event-stream")
+	w.Header.Override("Cache-Control", "no-cache")
+	w.Header.Override("Transfer-Encoding", "chunked")
+	// Asks reverse proxies not to hold events back either.
+	w.Header.Override("X-Accel-Buffering", "no")
+	if err := w.WriteHeaders(); err != nil {
+		return nil, err
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	return &EventStream{w: w, ctx: ctx}, nil
+}
+
+// Done is closed once the client has disconnected or the request has
+// otherwise ended.
+func (s *EventStream) Done() <-chan struct{} {
+	return s.ctx.Done()
+}
+
+// Send writes ev and flushes it.
+func (s *EventStream) Send(ev Event) error {
+	if strings.ContainsAny(ev.ID+ev.Event, "\r\n") {
+		return ErrInvalidEvent
+	}
+	var b strings.Builder
+	if ev.ID != "" {
+		b.WriteString("id: " + ev.ID + "\n")
+	}
+	if ev.Event != "" {
+		b.WriteString("event: " + ev.Event + "\n")
+	}
+	if ev.Retry > 0 {
+		b.WriteString("retry: " + strconv.FormatInt(ev.Retry.Milliseconds(), 10) + "\n")
+	}
+	for _, line := range splitLines(ev.Data) {
+		b.WriteString("data: " + line + "\n")
+	}
+	b.WriteString("\n")
+	return s.write(b.String())
+}
+
+// Comment writes a comment line, which clients ignore. Sent periodically it
+// keeps idle connections from being dropped by proxies.
+func (s *EventStream) Comment(text string) error {
+	var b strings.Builder
+	for _, line := range splitLines(text) {
+		b.WriteString(": " + line + "\n")
+	}
+	b.WriteString("\n")
+	return s.write(b.String())
+}
+
+// Serve sends every event received from events until the channel is closed
+// or the client disconnects, writing a heartbeat comment whenever nothing was
+// sent for heartbeat. A zero heartbeat disables them. It returns nil when
+// events is closed and the context's error on disconnect.
+func (s *EventStream) Serve(events <-chan Event, heartbeat time.Duration) error {
+	var (
+		ticker *time.Ticker
+		tick   <-chan time.Time
+	)
+	if heartbeat > 0 {
+		ticker = time.NewTicker(heartbeat)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-s.ctx.Done():
+			return s.ctx.Err()
+		case ev, ok := <-events:
+			if !ok {
+				return nil
+			}
+			if err := s.Send(ev); err != nil {
+				return err
+			}
+			if ticker != nil {
+				ticker.Reset(heartbeat)
+			}
+		case <-tick:
+			if err := s.Comment("heartbeat"); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (s *EventStream) write(text string) error {
+	if err := s.ctx.Err(); err != nil {
+		return err
+	}
+	if _, err := s.w.WriteChunkedBody([]byte(text)); err != nil {
+		return err
+	}
+	return s.w.Flush()
+}
+
+// splitLines splits on any of the line endings the event stream format
+// accepts, so none can sneak into a field.
+func splitLines(s string) []string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = strings.ReplaceAll(s, "\r", "\n")
+	return strings.Split(s, "\n")
+}
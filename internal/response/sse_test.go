@@ -0,0 +1,109 @@
+package response
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventStream(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	s, err := NewEventStream(context.Background(), w)
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Cache-Control: no-cache\r\n"+
+		"Content-Type: text/event-stream\r\n"+
+		"Transfer-Encoding: chunked\r\n"+
+		"X-Accel-Buffering: no\r\n"+
+		"\r\n", buf.String())
+
+	// Test: Events are flushed as soon as they are sent
+	buf.Reset()
+	require.NoError(t, s.Send(Event{ID: "1", Event: "log", Data: "line one\nline two\r\nline three", Retry: 3 * time.Second}))
+	want := "id: 1\nevent: log\nretry: 3000\ndata: line one\ndata: line two\ndata: line three\n\n"
+	assert.Equal(t, fmt.Sprintf("%x\r\n%s\r\n", len(want), want), buf.String())
+
+	buf.Reset()
+	require.NoError(t, s.Send(Event{Data: "x"}))
+	assert.Equal(t, "9\r\ndata: x\n\n\r\n", buf.String())
+
+	buf.Reset()
+	require.NoError(t, s.Comment("ping"))
+	assert.Equal(t, "8\r\n: ping\n\n\r\n", buf.String())
+
+	// Test: Line breaks in single-line fields are refused
+	assert.ErrorIs(t, s.Send(Event{ID: "1\ndata: evil"}), ErrInvalidEvent)
+	assert.ErrorIs(t, s.Send(Event{Event: "a\rb"}), ErrInvalidEvent)
+
+	// Test: Finish ends the stream
+	buf.Reset()
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "0\r\n\r\n", buf.String())
+
+	// Test: Headers already written
+	w = NewWriter(&bytes.Buffer{})
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders())
+	_, err = NewEventStream(context.Background(), w)
+	assert.Error(t, err)
+}
+
+func TestEventStreamServe(t *testing.T) {
+	// Test: Events and heartbeats until the channel is closed
+	buf := &bytes.Buffer{}
+	s, err := NewEventStream(context.Background(), NewWriter(buf))
+	require.NoError(t, err)
+	events := make(chan Event)
+	go func() {
+		events <- Event{Data: "first"}
+		time.Sleep(50 * time.Millisecond)
+		events <- Event{Data: "second"}
+		close(events)
+	}()
+	require.NoError(t, s.Serve(events, 10*time.Millisecond))
+	out := buf.String()
+	assert.Contains(t, out, "data: first\n\n")
+	assert.Contains(t, out, ": heartbeat\n\n")
+	assert.Less(t, strings.Index(out, "first"), strings.Index(out, "heartbeat"))
+	assert.Less(t, strings.Index(out, "heartbeat"), strings.Index(out, "second"))
+
+	// Test: Events arriving faster than the heartbeat hold it off
+	buf = &bytes.Buffer{}
+	s, err = NewEventStream(context.Background(), NewWriter(buf))
+	require.NoError(t, err)
+	events = make(chan Event)
+	go func() {
+		for i := 0; i < 10; i++ {
+			events <- Event{Data: "tick"}
+			time.Sleep(10 * time.Millisecond)
+		}
+		close(events)
+	}()
+	require.NoError(t, s.Serve(events, 50*time.Millisecond))
+	out = buf.String()
+	assert.Equal(t, 10, strings.Count(out, "data: tick\n\n"))
+	assert.NotContains(t, out, "heartbeat")
+
+	// Test: A disconnect stops the stream
+	ctx, cancel := context.WithCancel(context.Background())
+	s, err = NewEventStream(ctx, NewWriter(&bytes.Buffer{}))
+	require.NoError(t, err)
+	done := make(chan error)
+	go func() { done <- s.Serve(make(chan Event), 0) }()
+	cancel()
+	select {
+	case err := <-done:
+		assert.ErrorIs(t, err, context.Canceled)
+	case <-time.After(time.Second):
+		t.Fatal("Serve did not return after the context was cancelled")
+	}
+	<-s.Done()
+	assert.ErrorIs(t, s.Send(Event{Data: "late"}), context.Canceled)
+}
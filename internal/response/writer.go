@@ -1,11 +1,40 @@
 package response
 
 import (
+	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
 	"httpfromtcp/internal/headers"
 	"io"
+	"net"
+	"strconv"
 )
 
+// ErrBodyNotAllowed is returned when body content is written for a 1xx, 204
+// or 304 response.
+var ErrBodyNotAllowed = errors.New("response status does not allow a body")
+
+// ErrContentLength is returned when the body written doesn't match the
+// Content-Length header sent.
+var ErrContentLength = errors.New("body length does not match Content-Length")
+
+var (
+	// ErrNotHijackable is returned by Hijack when the server can't hand the
+	// connection over, e.g. because it is still reading requests from it.
+	ErrNotHijackable = errors.New("connection can't be hijacked")
+	// ErrHijacked is returned when the Writer is used after Hijack.
+	ErrHijacked = errors.New("connection has been hijacked")
+)
+
+// HijackFunc hands over the network connection together with any bytes the
+// server already read from it but did not consume.
+type HijackFunc func() (net.Conn, []byte, error)
+
+// DefaultBufferThreshold is how much of a response body written without a
+// Content-Length is held back so that one can be computed.
+const DefaultBufferThreshold = 4 << 10
+
 type writerState int
 
 const (
@@ -13,67 +42,536 @@ const (
 	stateStatusWritten
 	stateHeadersWritten
 	stateBodyWritten
+	stateHijacked
 )
 
 type Writer struct {
-	conn io.Writer
+	// out buffers everything written until Flush, so small writes don't
+	// each cost a syscall.
+	out *bufio.Writer
+	conn *sentWriter
 	state writerState
 	Header headers.Headers
 	status StatusCode
+	version string
+	// method is the request's method; the body of a response to HEAD is
+	// discarded.
+	method string
+	closeConn bool
+	// closeDelimited is set when chunked framing is unavailable and the body
+	// is instead ended by closing the connection.
+	closeDelimited bool
+	hooks []Hooks
+	bytesWritten int64
+	// contentLength is the Content-Length sent with the headers, or -1.
+	contentLength int64
+	// pending holds body bytes passed to Write before the headers, until
+	// they either fit under bufferThreshold at Finish or overflow it.
+	pending []byte
+	bufferThreshold int
+	hijack HijackFunc
+}
+
+// Hooks let middleware observe a response as a downstream handler writes it.
+// Either function may be nil.
+type Hooks struct {
+	// WriteHeaders is called with the status code and the final headers
+	// just before they are sent.
+	WriteHeaders func(code StatusCode, h headers.Headers)
+	// WriteBody is called with each piece of body content written, without
+	// any chunk framing.
+	WriteBody func(p []byte)
+}
+
+// sentWriter records whether anything has been written through it.
+type sentWriter struct {
+	w    io.Writer
+	sent bool
+}
+
+func (s *sentWriter) Write(p []byte) (int, error) {
+	n, err := s.w.Write(p)
+	if n > 0 {
+		s.sent = true
+	}
+	return n, err
 }
 
 func NewWriter(conn io.Writer) *Writer {
+	sw := &sentWriter{w: conn}
 	return &Writer{
-		conn: conn,
+		out: bufio.NewWriter(sw),
+		conn: sw,
 		state: statInit,
 		Header: headers.NewHeaders(),
+		version: "1.1",
+		contentLength: -1,
+		bufferThreshold: DefaultBufferThreshold,
+	}
+}
+
+// SetBufferThreshold sets how many bytes Write holds back when the handler
+// didn't set a Content-Length. A body that fits is sent with an exact
+// Content-Length; a longer one switches to chunked encoding. Zero or less
+// disables buffering.
+func (w *Writer) SetBufferThreshold(n int) {
+	w.bufferThreshold = max(n, 0)
+}
+
+// AddHooks registers hooks that run in the order they were added.
+func (w *Writer) AddHooks(h Hooks) {
+	w.hooks = append(w.hooks, h)
+}
+
+// Status returns the status code written so far, or 0 if the status line has
+// not been written yet.
+func (w *Writer) Status() StatusCode {
+	return w.status
+}
+
+// SetHijacker lets Hijack take over the connection. The server sets it for
+// requests that may switch protocols.
+func (w *Writer) SetHijacker(f HijackFunc) {
+	w.hijack = f
+}
+
+// Hijack flushes anything written so far and hands the connection over to
+// the caller, who becomes responsible for closing it. The returned reader
+// yields bytes the server read ahead before anything new from the
+// connection; the writer is still buffered and needs flushing. The Writer
+// can't be used afterwards.
+func (w *Writer) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if w.state == stateHijacked {
+		return nil, nil, ErrHijacked
+	}
+	if w.hijack == nil {
+		return nil, nil, ErrNotHijackable
+	}
+	if err := w.out.Flush(); err != nil {
+		return nil, nil, err
+	}
+	c, buffered, err := w.hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	w.state = stateHijacked
+	r := bufio.NewReader(io.MultiReader(bytes.NewReader(buffered), c))
+	return c, bufio.NewReadWriter(r, w.out), nil
+}
+
+// Hijacked reports whether Hijack has taken over the connection.
+func (w *Writer) Hijacked() bool {
+	return w.state == stateHijacked
+}
+
+// Sent reports whether any part of the final response has reached the
+// connection. Until then Reset can still replace it.
+func (w *Writer) Sent() bool {
+	return w.conn.sent
+}
+
+// Reset discards the response written so far so a different one can be
+// sent instead, e.g. an error after the handler failed halfway. Settings such
+// as the HTTP version and connection close are kept. It fails once output has
+// been sent.
+func (w *Writer) Reset() error {
+	if w.state == stateHijacked {
+		return ErrHijacked
+	}
+	if w.Sent() {
+		return fmt.Errorf("response already sent")
+	}
+	w.out.Reset(w.conn)
+	w.state = statInit
+	w.status = 0
+	w.Header = headers.NewHeaders()
+	w.closeDelimited = false
+	w.bytesWritten = 0
+	w.contentLength = -1
+	w.pending = nil
+	return nil
+}
+
+// BytesWritten returns the number of body bytes written, excluding framing.
+// Bytes held back by Write count as written.
+func (w *Writer) BytesWritten() int64 {
+	return w.bytesWritten + int64(len(w.pending))
+}
+
+func (w *Writer) wroteBody(p []byte) {
+	w.bytesWritten += int64(len(p))
+	for _, h := range w.hooks {
+		if h.WriteBody != nil {
+			h.WriteBody(p)
+		}
 	}
 }
 
+// SetHttpVersion sets the version sent in the status line, normally the one
+// the client used. Must be called before WriteStatusLine.
+func (w *Writer) SetHttpVersion(version string) {
+	w.version = version
+}
+
+// SetRequestMethod tells the writer which request it answers. For HEAD the
+// headers go out as usual but body content is discarded, since a response to
+// HEAD ends with its header section (RFC 9112 6.3).
+func (w *Writer) SetRequestMethod(method string) {
+	w.method = method
+}
+
+// bodyOmitted reports whether body content is dropped even though the
+// headers describe it.
+func (w *Writer) bodyOmitted() bool {
+	return w.method == "HEAD"
+}
+
 func (w *Writer) WriteStatusLine(code StatusCode) error {
 	if w.state != statInit {
 		return fmt.Errorf("status line already written or out of order")
 	}
+	if isInterim(code) && w.version == "1.0" {
+		return fmt.Errorf("interim responses cannot be sent to HTTP/1.0 clients")
+	}
 	w.status = code
-	err := writeStatusLineTo(w.conn, code)
+	err := writeStatusLineTo(w.out, w.version, code)
 	if err == nil {
 		w.state = stateStatusWritten
 	}
 	return err
 }
 
+// SetConnectionClose marks the response as the last one on the connection.
+// WriteHeaders then announces it with a Connection: close header.
+func (w *Writer) SetConnectionClose() {
+	w.closeConn = true
+}
+
+// ConnectionClose reports whether the connection has to be closed after this
+// response, either because one side asked for it or because the response was
+// left incomplete or is delimited only by closing the connection.
+func (w *Writer) ConnectionClose() bool {
+	if w.closeConn || w.Header.HasToken("Connection", "close") || w.state == stateHijacked {
+		return true
+	}
+	switch {
+	case w.state == statInit || w.state == stateStatusWritten:
+		return true
+	case !bodyAllowed(w.status) || w.bodyOmitted():
+		return false
+	case w.isChunked():
+		return w.state != stateBodyWritten
+	case w.Header.Get("Content-Length") == "":
+		return true
+	}
+	return false
+}
+
 func (w *Writer) WriteHeaders() error {
 	if w.state != stateStatusWritten {
 		return fmt.Errorf("must write status line before headers")
 	}
-	err := writeHeadersTo(w.conn, w.Header)
-	if err == nil {
-		w.state = stateHeadersWritten
+	if len(w.pending) > 0 {
+		return fmt.Errorf("headers already implied by Write")
 	}
-	return err
+	if isInterim(w.status) {
+		return w.writeInterimHeaders()
+	}
+	if !bodyAllowed(w.status) {
+		w.removeFraming()
+	} else {
+		// A sender must not use both framings (RFC 9112 6.2); chunked wins.
+		if w.isChunked() {
+			w.Header.Del("Content-Length")
+		}
+		if w.version == "1.0" {
+			w.prepareHTTP10Headers()
+		}
+	}
+	// A 101 hands the connection to another protocol, which decides when
+	// it ends; its Connection header has to name the upgrade instead.
+	if w.closeConn && w.status != StatusSwitchingProtocols {
+		w.Header.Override("Connection", "close")
+	}
+	for _, h := range w.hooks {
+		if h.WriteHeaders != nil {
+			h.WriteHeaders(w.status, w.Header)
+		}
+	}
+	err := writeHeadersTo(w.out, w.Header)
+	if err != nil {
+		return err
+	}
+	w.state = stateHeadersWritten
+	if bodyAllowed(w.status) && !w.isChunked() {
+		if n, err := strconv.ParseInt(w.Header.Get("Content-Length"), 10, 64); err == nil {
+			w.contentLength = n
+		}
+	}
+	return nil
+}
+
+func (w *Writer) isChunked() bool {
+	return w.Header.HasToken("Transfer-Encoding", "chunked")
 }
 
+// writeInterimHeaders sends the header section of a 1xx response and resets
+// the writer so the final response can follow.
+func (w *Writer) writeInterimHeaders() error {
+	w.removeFraming()
+	err := writeHeadersTo(w.out, w.Header)
+	if err != nil {
+		return err
+	}
+	// The client may be waiting for this before sending the request body.
+	if err := w.out.Flush(); err != nil {
+		return err
+	}
+	// The final response is still to come.
+	w.conn.sent = false
+	w.state = statInit
+	w.status = 0
+	w.Header = headers.NewHeaders()
+	return nil
+}
+
+// removeFraming strips the framing headers a response without content must
+// not carry. A 304 keeps Content-Length, which there describes the
+// representation the client already has.
+func (w *Writer) removeFraming() {
+	w.Header.Del("Transfer-Encoding")
+	w.Header.Del("Trailer")
+	if w.status != StatusNotModified {
+		w.Header.Del("Content-Length")
+	}
+}
+
+// HTTP/1.0 clients don't understand chunked encoding, so a chunked response
+// falls back to a body delimited by closing the connection, and trailers are
+// dropped. Connections are only kept open when explicitly announced.
+func (w *Writer) prepareHTTP10Headers() {
+	if w.isChunked() {
+		w.Header.Del("Transfer-Encoding")
+		w.Header.Del("Trailer")
+		w.closeDelimited = true
+		w.closeConn = true
+	}
+	if w.Header.Get("Content-Length") == "" {
+		w.closeConn = true
+	}
+	if !w.closeConn {
+		w.Header.Override("Connection", "keep-alive")
+	}
+}
+
+// WriteBody sends p unframed as the next part of the body and may be called
+// any number of times after WriteHeaders. Output is buffered; call Flush to
+// push it to the client before the handler returns.
 func (w *Writer) WriteBody(p []byte) (int, error) {
 	if w.state != stateHeadersWritten {
 		return 0, fmt.Errorf("must write headers before body")
 	}
-	w.state = stateBodyWritten
-	return w.conn.Write(p)
+	return w.writeBody(p)
+}
+
+// writeBody sends p unframed, refusing to go past the declared
+// Content-Length so the connection stays in sync for the next response.
+func (w *Writer) writeBody(p []byte) (int, error) {
+	if !bodyAllowed(w.status) && len(p) > 0 {
+		return 0, ErrBodyNotAllowed
+	}
+	if w.bodyOmitted() {
+		return len(p), nil
+	}
+	if w.contentLength >= 0 && w.bytesWritten+int64(len(p)) > w.contentLength {
+		return 0, ErrContentLength
+	}
+	n, err := w.out.Write(p)
+	w.wroteBody(p[:n])
+	return n, err
+}
+
+// Write sends p as part of the body, first writing a 200 status line if the
+// handler hasn't, so it can be called any number of times, e.g. by
+// fmt.Fprintf or io.Copy. If the handler set neither Content-Length nor
+// Transfer-Encoding, the body is held back up to the buffer threshold: a body
+// that fits goes out at Finish with a computed Content-Length, a longer one
+// is sent chunked as soon as it overflows. Finish ends the body.
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.state == stateHijacked {
+		return 0, ErrHijacked
+	}
+	if w.state == statInit {
+		if err := w.WriteStatusLine(StatusOK); err != nil {
+			return 0, err
+		}
+	}
+	if w.state == stateStatusWritten {
+		// Checked now rather than when the held back body goes out, which
+		// may be after the handler has returned.
+		if err := w.Header.Validate(); err != nil {
+			return 0, err
+		}
+		if w.lengthUnknown() {
+			if len(w.pending)+len(p) <= w.bufferThreshold {
+				w.pending = append(w.pending, p...)
+				return len(p), nil
+			}
+			w.Header.Override("Transfer-Encoding", "chunked")
+		}
+		w.setDefaultContentType()
+		if err := w.writeImplicitHeaders(); err != nil {
+			return 0, err
+		}
+	}
+	if w.state != stateHeadersWritten {
+		return 0, fmt.Errorf("body already finished")
+	}
+	return w.writeFramed(p)
+}
+
+// Finish completes the response with whatever the handler left out: a 200
+// status line, the headers with a Content-Length for any body held back by
+// Write, or the end of a chunked body. The server calls it after the handler
+// returns, and everything written is flushed unless the headers couldn't be
+// written, e.g. because they failed validation. A body shorter than its
+// Content-Length can't be repaired, so the connection is marked for closing
+// and ErrContentLength returned.
+func (w *Writer) Finish() error {
+	// The buffered writer now belongs to whoever hijacked the connection.
+	if w.state == stateHijacked {
+		return nil
+	}
+	err := w.finish()
+	// Without its headers the response is unusable; it is kept back so the
+	// caller can Reset and send an error response instead.
+	if w.state == statInit || w.state == stateStatusWritten {
+		return err
+	}
+	if flushErr := w.out.Flush(); err == nil {
+		err = flushErr
+	}
+	return err
+}
+
+func (w *Writer) finish() error {
+	switch w.state {
+	case statInit:
+		if err := w.WriteStatusLine(StatusOK); err != nil {
+			return err
+		}
+		fallthrough
+	case stateStatusWritten:
+		if w.lengthUnknown() {
+			w.Header.Override("Content-Length", strconv.Itoa(len(w.pending)))
+		}
+		if len(w.pending) > 0 {
+			w.setDefaultContentType()
+		}
+		if err := w.writeImplicitHeaders(); err != nil {
+			return err
+		}
+	}
+	if w.state == stateHeadersWritten {
+		if w.isChunked() || w.closeDelimited || !bodyAllowed(w.status) {
+			return w.WriteChunkedBodyDoneWithTrailers(headers.NewHeaders())
+		}
+		w.state = stateBodyWritten
+	}
+	if w.contentLength >= 0 && w.bytesWritten < w.contentLength && !w.bodyOmitted() {
+		w.closeConn = true
+		return ErrContentLength
+	}
+	return nil
+}
+
+// Flush sends everything written so far to the client. Headers not yet sent
+// go out first, with a 200 status line if none was written; since the body
+// length can't be known at that point, it is sent chunked unless the handler
+// set a Content-Length.
+func (w *Writer) Flush() error {
+	if w.state == stateHijacked {
+		return ErrHijacked
+	}
+	if w.state == statInit {
+		if err := w.WriteStatusLine(StatusOK); err != nil {
+			return err
+		}
+	}
+	if w.state == stateStatusWritten {
+		if w.lengthUnknown() {
+			w.Header.Override("Transfer-Encoding", "chunked")
+		}
+		w.setDefaultContentType()
+		if err := w.writeImplicitHeaders(); err != nil {
+			return err
+		}
+	}
+	return w.out.Flush()
+}
+
+// lengthUnknown reports whether the handler left the body framing up to the
+// writer.
+func (w *Writer) lengthUnknown() bool {
+	return bodyAllowed(w.status) && w.Header.Get("Content-Length") == "" && w.Header.Get("Transfer-Encoding") == ""
+}
+
+func (w *Writer) setDefaultContentType() {
+	if bodyAllowed(w.status) && w.Header.Get("Content-Type") == "" {
+		w.Header.Override("Content-Type", "text/plain")
+	}
+}
+
+// writeImplicitHeaders writes the headers on behalf of Write or Finish,
+// followed by any body held back so far.
+func (w *Writer) writeImplicitHeaders() error {
+	pending := w.pending
+	w.pending = nil
+	if err := w.WriteHeaders(); err != nil {
+		w.pending = pending
+		return err
+	}
+	_, err := w.writeFramed(pending)
+	return err
+}
+
+// writeFramed sends body content using whichever framing the headers chose.
+func (w *Writer) writeFramed(p []byte) (int, error) {
+	if w.isChunked() || w.closeDelimited {
+		return w.WriteChunkedBody(p)
+	}
+	return w.writeBody(p)
 }
 
 func (w *Writer) WriteChunkedBody(p []byte) (int, error) {
 	if w.state != stateHeadersWritten {
 		return 0, fmt.Errorf("must write headers before body")
 	}
-	_, err := fmt.Fprintf(w.conn, "%x\r\n", len(p))
+	if !bodyAllowed(w.status) {
+		return 0, ErrBodyNotAllowed
+	}
+	if w.bodyOmitted() {
+		return len(p), nil
+	}
+	// An empty chunk would end the body.
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if w.closeDelimited {
+		n, err := w.out.Write(p)
+		w.wroteBody(p[:n])
+		return n, err
+	}
+	_, err := fmt.Fprintf(w.out, "%x\r\n", len(p))
 	if err != nil {
 		return 0, err
 	}
-	n, err := w.conn.Write(p)
+	n, err := w.out.Write(p)
+	w.wroteBody(p[:n])
 	if err != nil {
 		return n, err
 	}
-	_, err = w.conn.Write([]byte("\r\n"))
+	_, err = w.out.Write([]byte("\r\n"))
 	if err != nil {
 		return n, err
 	}
@@ -89,19 +587,20 @@ func (w *Writer) WriteChunkedBodyDoneWithTrailers(h headers.Headers) error {
 	if w.state != stateHeadersWritten {
 		return fmt.Errorf("must write headers before finishing chunked body")
 	}
-	_, err := w.conn.Write([]byte("0\r\n"))
-	if err != nil {
+	if w.closeDelimited || !bodyAllowed(w.status) || w.bodyOmitted() {
+		w.state = stateBodyWritten
+		return nil
+	}
+	// Checked before the last chunk goes out so the handler can still fix
+	// the trailers and retry.
+	if err := h.Validate(); err != nil {
 		return err
 	}
-
-	for k, v := range h {
-		_, err := fmt.Fprintf(w.conn, "%s: %s\r\n", k, v)
-		if err != nil {
-			return err
-		}
+	_, err := w.out.Write([]byte("0\r\n"))
+	if err != nil {
+		return err
 	}
-
-	_, err = w.conn.Write([]byte("\r\n"))
+	err = writeHeadersTo(w.out, h)
 	if err != nil {
 		return err
 	}
@@ -114,12 +613,8 @@ func (w *Writer) WriteTrailers(h headers.Headers) error {
 	if w.state != stateBodyWritten {
 		return fmt.Errorf("must write body before trailers")
 	}
-	for k, v := range h {
-		_, err := fmt.Fprintf(w.conn, "%s: %s\r\n", k, v)
-		if err != nil {
-			return err
-		}
+	if w.bodyOmitted() {
+		return nil
 	}
-	_, err := w.conn.Write([]byte("\r\n"))
-	return err
+	return writeHeadersTo(w.out, h)
 }
\ No newline at end of file
@@ -0,0 +1,500 @@
+package response
+
+import (
+	"bytes"
+	"fmt"
+	"httpfromtcp/internal/headers"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriterHTTP10(t *testing.T) {
+	// Test: Status line matches the negotiated version
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	w.SetHttpVersion("1.0")
+	w.SetConnectionClose()
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	w.Header = GetDefaultHeaders(2)
+	require.NoError(t, w.WriteHeaders())
+	_, err := w.WriteBody([]byte("hi"))
+	require.NoError(t, err)
+	require.NoError(t, w.Flush())
+	assert.Contains(t, buf.String(), "HTTP/1.0 200 OK\r\n")
+	assert.Contains(t, buf.String(), "Connection: close\r\n")
+	assert.True(t, w.ConnectionClose())
+
+	// Test: Keep-alive is announced when the connection stays open
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.SetHttpVersion("1.0")
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	w.Header = GetDefaultHeaders(2)
+	require.NoError(t, w.WriteHeaders())
+	_, err = w.WriteBody([]byte("hi"))
+	require.NoError(t, err)
+	require.NoError(t, w.Flush())
+	assert.Contains(t, buf.String(), "Connection: keep-alive\r\n")
+	assert.False(t, w.ConnectionClose())
+
+	// Test: Chunked responses fall back to close-delimited bodies
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.SetHttpVersion("1.0")
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	w.Header.Set("Transfer-Encoding", "chunked")
+	w.Header.Set("Trailer", "X-Checksum")
+	require.NoError(t, w.WriteHeaders())
+	_, err = w.WriteChunkedBody([]byte("hello "))
+	require.NoError(t, err)
+	_, err = w.WriteChunkedBody([]byte("world"))
+	require.NoError(t, err)
+	trailers := NewHeaders()
+	trailers.Set("X-Checksum", "abc")
+	require.NoError(t, w.WriteChunkedBodyDoneWithTrailers(trailers))
+	require.NoError(t, w.Flush())
+	assert.NotContains(t, buf.String(), "Transfer-Encoding")
+	assert.NotContains(t, buf.String(), "X-Checksum")
+	assert.Contains(t, buf.String(), "Connection: close\r\n")
+	assert.True(t, bytes.HasSuffix(buf.Bytes(), []byte("\r\n\r\nhello world")))
+	assert.True(t, w.ConnectionClose())
+}
+
+func TestWriterHTTP11Chunked(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	w.Header.Set("Transfer-Encoding", "chunked")
+	require.NoError(t, w.WriteHeaders())
+	_, err := w.WriteChunkedBody([]byte("hello"))
+	require.NoError(t, err)
+	assert.True(t, w.ConnectionClose())
+	_, err = w.WriteChunkedBodyDone()
+	require.NoError(t, err)
+	require.NoError(t, w.Flush())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n0\r\n\r\n", buf.String())
+	assert.False(t, w.ConnectionClose())
+}
+
+func TestStatusText(t *testing.T) {
+	assert.Equal(t, "Created", StatusText(StatusCreated))
+	assert.Equal(t, "Not Modified", StatusText(StatusNotModified))
+	assert.Equal(t, "Service Unavailable", StatusText(StatusServiceUnavailable))
+	assert.Equal(t, "", StatusText(299))
+	assert.Equal(t, "HTTP/1.1 301 Moved Permanently\r\n", getStatusLine("1.1", StatusMovedPermanently))
+	assert.Equal(t, "HTTP/1.1 299 \r\n", getStatusLine("1.1", 299))
+}
+
+func TestWriterNoBodyStatuses(t *testing.T) {
+	// Test: 204 drops framing headers and refuses content
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	require.NoError(t, w.WriteStatusLine(StatusNoContent))
+	w.Header = GetDefaultHeaders(0)
+	require.NoError(t, w.WriteHeaders())
+	_, err := w.WriteBody([]byte("nope"))
+	assert.ErrorIs(t, err, ErrBodyNotAllowed)
+	_, err = w.WriteBody(nil)
+	require.NoError(t, err)
+	require.NoError(t, w.Flush())
+	assert.Equal(t, "HTTP/1.1 204 No Content\r\nContent-Type: text/plain\r\n\r\n", buf.String())
+	assert.False(t, w.ConnectionClose())
+
+	// Test: 304 keeps Content-Length but never sends chunked framing
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	require.NoError(t, w.WriteStatusLine(StatusNotModified))
+	w.Header.Set("Content-Length", "42")
+	w.Header.Set("Transfer-Encoding", "chunked")
+	require.NoError(t, w.WriteHeaders())
+	_, err = w.WriteChunkedBody([]byte("data"))
+	assert.ErrorIs(t, err, ErrBodyNotAllowed)
+	_, err = w.WriteChunkedBodyDone()
+	require.NoError(t, err)
+	require.NoError(t, w.Flush())
+	assert.Equal(t, "HTTP/1.1 304 Not Modified\r\nContent-Length: 42\r\n\r\n", buf.String())
+	assert.False(t, w.ConnectionClose())
+
+	// Test: No-content responses to HTTP/1.0 clients keep the connection
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.SetHttpVersion("1.0")
+	require.NoError(t, w.WriteStatusLine(StatusNoContent))
+	require.NoError(t, w.WriteHeaders())
+	assert.False(t, w.ConnectionClose())
+}
+
+func TestWriterHead(t *testing.T) {
+	// Test: Implicit headers describe the body that is left out
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	w.SetRequestMethod("HEAD")
+	fmt.Fprint(w, "hello")
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 5\r\nContent-Type: text/plain\r\n\r\n", buf.String())
+	assert.False(t, w.ConnectionClose())
+
+	// Test: An explicit Content-Length needn't be matched
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.SetRequestMethod("HEAD")
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	w.Header = GetDefaultHeaders(100)
+	require.NoError(t, w.WriteHeaders())
+	require.NoError(t, w.Finish())
+	assert.True(t, strings.HasSuffix(buf.String(), "Content-Length: 100\r\nContent-Type: text/plain\r\n\r\n"), buf.String())
+	assert.False(t, w.ConnectionClose())
+
+	// Test: Chunked bodies send neither chunks nor the last chunk
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.SetRequestMethod("HEAD")
+	w.SetBufferThreshold(0)
+	fmt.Fprint(w, "streamed")
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nTransfer-Encoding: chunked\r\n\r\n", buf.String())
+	assert.False(t, w.ConnectionClose())
+}
+
+func TestWriterInterimResponse(t *testing.T) {
+	// Test: 100 Continue is followed by the final response
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	require.NoError(t, w.WriteStatusLine(StatusContinue))
+	require.NoError(t, w.WriteHeaders())
+	assert.Equal(t, StatusCode(0), w.Status())
+	require.NoError(t, w.WriteStatusLine(StatusCreated))
+	w.Header = GetDefaultHeaders(2)
+	require.NoError(t, w.WriteHeaders())
+	_, err := w.WriteBody([]byte("ok"))
+	require.NoError(t, err)
+	require.NoError(t, w.Flush())
+	assert.True(t, bytes.HasPrefix(buf.Bytes(), []byte("HTTP/1.1 100 Continue\r\n\r\nHTTP/1.1 201 Created\r\n")))
+	assert.Equal(t, StatusCreated, w.Status())
+
+	// Test: HTTP/1.0 clients never get interim responses
+	w = NewWriter(&bytes.Buffer{})
+	w.SetHttpVersion("1.0")
+	assert.Error(t, w.WriteStatusLine(StatusContinue))
+}
+
+func TestWriteHeadersDeterministic(t *testing.T) {
+	h := NewHeaders()
+	h.Set("x-request-id", "abc")
+	h.Set("content-type", "text/plain")
+	h.Set("ETag", `"v1"`)
+	h.Set("CONTENT-LENGTH", "0")
+	h.Set("www-authenticate", "Basic")
+
+	want := "Content-Length: 0\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"ETag: \"v1\"\r\n" +
+		"WWW-Authenticate: Basic\r\n" +
+		"X-Request-Id: abc\r\n" +
+		"\r\n"
+	for i := 0; i < 10; i++ {
+		buf := &bytes.Buffer{}
+		require.NoError(t, writeHeadersTo(buf, h))
+		assert.Equal(t, want, buf.String())
+	}
+
+	// Test: Trailers are serialised the same way
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	w.Header.Set("Transfer-Encoding", "chunked")
+	require.NoError(t, w.WriteHeaders())
+	trailers := NewHeaders()
+	trailers.Set("x-content-sha256", "abc")
+	trailers.Set("x-content-length", "0")
+	require.NoError(t, w.WriteChunkedBodyDoneWithTrailers(trailers))
+	require.NoError(t, w.Flush())
+	assert.True(t, bytes.HasSuffix(buf.Bytes(), []byte("0\r\nX-Content-Length: 0\r\nX-Content-Sha256: abc\r\n\r\n")))
+}
+
+func TestWriteHeadersMultiValued(t *testing.T) {
+	h := NewHeaders()
+	h.Add("Set-Cookie", "a=1; Expires=Wed, 21 Oct 2026 07:28:00 GMT")
+	h.Add("Set-Cookie", "b=2")
+	h.Add("Vary", "Accept")
+	h.Add("Vary", "Accept-Encoding")
+	buf := &bytes.Buffer{}
+	require.NoError(t, writeHeadersTo(buf, h))
+	assert.Equal(t, "Set-Cookie: a=1; Expires=Wed, 21 Oct 2026 07:28:00 GMT\r\n"+
+		"Set-Cookie: b=2\r\n"+
+		"Vary: Accept\r\n"+
+		"Vary: Accept-Encoding\r\n"+
+		"\r\n", buf.String())
+}
+
+func TestWriterRejectsHeaderInjection(t *testing.T) {
+	// Test: Nothing is written and the handler can fix the headers
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	w.Header = GetDefaultHeaders(0)
+	w.Header.Set("X-Foo", "a\r\nSet-Cookie: evil")
+	assert.ErrorIs(t, w.WriteHeaders(), headers.ErrInvalidFieldValue)
+	w.Header.Override("X-Foo", "a")
+	require.NoError(t, w.WriteHeaders())
+	require.NoError(t, w.Flush())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 0\r\nContent-Type: text/plain\r\nX-Foo: a\r\n\r\n", buf.String())
+
+	// Test: Invalid field names are rejected
+	w = NewWriter(&bytes.Buffer{})
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	w.Header.Set("Bad Name", "x")
+	assert.ErrorIs(t, w.WriteHeaders(), headers.ErrInvalidFieldName)
+
+	// Test: Trailers are checked before the last chunk is sent
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	w.Header.Set("Transfer-Encoding", "chunked")
+	require.NoError(t, w.WriteHeaders())
+	require.NoError(t, w.Flush())
+	trailers := NewHeaders()
+	trailers.Set("X-Checksum", "abc\nX-Evil: 1")
+	before := buf.Len()
+	assert.ErrorIs(t, w.WriteChunkedBodyDoneWithTrailers(trailers), headers.ErrInvalidFieldValue)
+	require.NoError(t, w.Flush())
+	assert.Equal(t, before, buf.Len())
+	trailers.Override("X-Checksum", "abc")
+	require.NoError(t, w.WriteChunkedBodyDoneWithTrailers(trailers))
+
+	// Test: Write reports invalid headers even while it buffers the body
+	w = NewWriter(&bytes.Buffer{})
+	w.Header.Set("X-Foo", "a\r\nb")
+	_, err := fmt.Fprint(w, "small")
+	assert.ErrorIs(t, err, headers.ErrInvalidFieldValue)
+	assert.Zero(t, w.BytesWritten())
+	w.Header.Override("X-Foo", "a")
+	n, err := fmt.Fprint(w, "small")
+	require.NoError(t, err)
+	assert.Equal(t, 5, n)
+}
+
+func TestWriterImplicit(t *testing.T) {
+	// Test: Without buffering, Write sends an implicit 200 and a chunked body
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	w.SetBufferThreshold(0)
+	fmt.Fprintf(w, "hello %d", 42)
+	_, err := w.Write(nil)
+	require.NoError(t, err)
+	fmt.Fprint(w, "!")
+	assert.True(t, w.ConnectionClose())
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"Transfer-Encoding: chunked\r\n"+
+		"\r\n"+
+		"8\r\nhello 42\r\n"+
+		"1\r\n!\r\n"+
+		"0\r\n\r\n", buf.String())
+	assert.False(t, w.ConnectionClose())
+	assert.Equal(t, StatusOK, w.Status())
+
+	// Test: Explicit status and Content-Length are respected
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	require.NoError(t, w.WriteStatusLine(StatusCreated))
+	w.Header.Set("Content-Type", "application/json")
+	w.Header.Set("Content-Length", "2")
+	_, err = io.Copy(w, strings.NewReader("{}"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 201 Created\r\nContent-Length: 2\r\nContent-Type: application/json\r\n\r\n{}", buf.String())
+	assert.False(t, w.ConnectionClose())
+
+	// Test: Writing past Content-Length fails without writing
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.Header.Set("Content-Length", "2")
+	_, err = w.Write([]byte("abc"))
+	assert.ErrorIs(t, err, ErrContentLength)
+	assert.False(t, strings.HasSuffix(buf.String(), "abc"))
+
+	// Test: A short body marks the connection for closing
+	w = NewWriter(&bytes.Buffer{})
+	w.Header.Set("Content-Length", "5")
+	_, err = w.Write([]byte("abc"))
+	require.NoError(t, err)
+	assert.ErrorIs(t, w.Finish(), ErrContentLength)
+	assert.True(t, w.ConnectionClose())
+
+	// Test: Finish without any writes sends an empty 200
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n", buf.String())
+	assert.False(t, w.ConnectionClose())
+
+	// Test: Finish after the explicit API is a no-op
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	w.Header = GetDefaultHeaders(2)
+	require.NoError(t, w.WriteHeaders())
+	_, err = w.WriteBody([]byte("hi"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\nhi"))
+
+	// Test: HTTP/1.0 clients get a close-delimited body
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.SetHttpVersion("1.0")
+	w.SetBufferThreshold(0)
+	fmt.Fprint(w, "old")
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.0 200 OK\r\nConnection: close\r\nContent-Type: text/plain\r\n\r\nold", buf.String())
+	assert.True(t, w.ConnectionClose())
+
+	// Test: A 204 sends no body and no framing
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	require.NoError(t, w.WriteStatusLine(StatusNoContent))
+	_, err = w.Write([]byte("x"))
+	assert.ErrorIs(t, err, ErrBodyNotAllowed)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 204 No Content\r\n\r\n", buf.String())
+	assert.False(t, w.ConnectionClose())
+}
+
+func TestWriterFraming(t *testing.T) {
+	// Test: A body under the threshold gets a computed Content-Length
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	fmt.Fprint(w, "hello ")
+	fmt.Fprint(w, "world")
+	assert.Empty(t, buf.String())
+	assert.Equal(t, int64(11), w.BytesWritten())
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 11\r\nContent-Type: text/plain\r\n\r\nhello world", buf.String())
+	assert.False(t, w.ConnectionClose())
+
+	// Test: Overflowing the threshold switches to chunked
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.SetBufferThreshold(8)
+	fmt.Fprint(w, "hello")
+	fmt.Fprint(w, " world")
+	fmt.Fprint(w, "!")
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"Transfer-Encoding: chunked\r\n"+
+		"\r\n"+
+		"5\r\nhello\r\n"+
+		"6\r\n world\r\n"+
+		"1\r\n!\r\n"+
+		"0\r\n\r\n", buf.String())
+
+	// Test: Chunked encoding drops a conflicting Content-Length
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.Header = GetDefaultHeaders(0)
+	w.Header.Set("Transfer-Encoding", "chunked")
+	fmt.Fprint(w, "abc")
+	require.NoError(t, w.Finish())
+	assert.NotContains(t, buf.String(), "Content-Length")
+	assert.Contains(t, buf.String(), "3\r\nabc\r\n0\r\n\r\n")
+
+	// Test: Small responses let HTTP/1.0 connections stay open
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.SetHttpVersion("1.0")
+	fmt.Fprint(w, "old")
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.0 200 OK\r\nConnection: keep-alive\r\nContent-Length: 3\r\nContent-Type: text/plain\r\n\r\nold", buf.String())
+	assert.False(t, w.ConnectionClose())
+
+	// Test: Explicit WriteHeaders can't follow buffered writes
+	w = NewWriter(&bytes.Buffer{})
+	fmt.Fprint(w, "abc")
+	assert.Error(t, w.WriteHeaders())
+}
+
+func TestWriterReset(t *testing.T) {
+	// Test: Unsent output is discarded for a different response
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	w.SetHttpVersion("1.0")
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	w.Header = GetDefaultHeaders(100)
+	require.NoError(t, w.WriteHeaders())
+	_, err := w.WriteBody([]byte("partial"))
+	require.NoError(t, err)
+	assert.False(t, w.Sent())
+	require.NoError(t, w.Reset())
+	assert.Equal(t, StatusCode(0), w.Status())
+	fmt.Fprint(w, "error")
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.0 200 OK\r\nConnection: keep-alive\r\nContent-Length: 5\r\nContent-Type: text/plain\r\n\r\nerror", buf.String())
+	assert.True(t, w.Sent())
+
+	// Test: Nothing can be taken back once it was sent
+	assert.Error(t, w.Reset())
+
+	// Test: An interim response doesn't count as sent
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	require.NoError(t, w.WriteStatusLine(StatusContinue))
+	require.NoError(t, w.WriteHeaders())
+	assert.NotEmpty(t, buf.String())
+	assert.False(t, w.Sent())
+	require.NoError(t, w.Reset())
+}
+
+func TestWriterBufferingAndFlush(t *testing.T) {
+	// Test: WriteBody can be called repeatedly and output waits for Flush
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	w.Header = GetDefaultHeaders(11)
+	require.NoError(t, w.WriteHeaders())
+	for _, part := range []string{"hello", " ", "world"} {
+		_, err := w.WriteBody([]byte(part))
+		require.NoError(t, err)
+	}
+	assert.Empty(t, buf.String())
+	require.NoError(t, w.Flush())
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\nhello world"))
+	_, err := w.WriteBody([]byte("!"))
+	assert.ErrorIs(t, err, ErrContentLength)
+	require.NoError(t, w.Finish())
+	assert.False(t, w.ConnectionClose())
+
+	// Test: Flush commits implicit headers and switches to chunked
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	fmt.Fprint(w, "event 1")
+	require.NoError(t, w.Flush())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"Transfer-Encoding: chunked\r\n"+
+		"\r\n"+
+		"7\r\nevent 1\r\n", buf.String())
+	fmt.Fprint(w, "event 2")
+	assert.NotContains(t, buf.String(), "event 2")
+	require.NoError(t, w.Flush())
+	assert.True(t, strings.HasSuffix(buf.String(), "7\r\nevent 2\r\n"))
+
+	// Test: Finish flushes whatever is left
+	require.NoError(t, w.Finish())
+	assert.True(t, strings.HasSuffix(buf.String(), "0\r\n\r\n"))
+
+	// Test: Flush keeps a Content-Length set by the handler
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.Header.Set("Content-Length", "4")
+	fmt.Fprint(w, "ab")
+	require.NoError(t, w.Flush())
+	assert.NotContains(t, buf.String(), "Transfer-Encoding")
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\nab"))
+}
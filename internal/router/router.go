@@ -0,0 +1,238 @@
+package router
+
+import (
+	"fmt"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"httpfromtcp/internal/server"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// AnyMethod registers a route that matches every request method.
+const AnyMethod = "*"
+
+type segmentKind int
+
+// Ordered from most to least specific.
+const (
+	segmentLiteral segmentKind = iota
+	segmentParam
+	segmentWildcard
+)
+
+type segment struct {
+	kind  segmentKind
+	value string
+}
+
+type route struct {
+	method   string
+	pattern  string
+	segments []segment
+	handler  server.Handler
+}
+
+// Router dispatches requests by method and path pattern. Patterns are made of
+// literal segments, {name} segments matching exactly one path segment, and an
+// optional trailing {name...} segment matching the rest of the path, possibly
+// empty. Matched values are available through Request.PathValue. When several
+// routes accept the request's method and path, the most specific pattern
+// wins: literals beat parameters, which beat wildcards. A method-specific
+// route beats an AnyMethod one with the same pattern. A path matched only by
+// routes for other methods gets a 405 listing them in Allow.
+type Router struct {
+	routes []*route
+}
+
+func New() *Router {
+	return &Router{}
+}
+
+// Handle registers handler for method and pattern. It panics on malformed
+// patterns and on duplicate registrations.
+func (rt *Router) Handle(method, pattern string, handler server.Handler) {
+	segments, err := parsePattern(pattern)
+	if err != nil {
+		panic(fmt.Sprintf("router: %v", err))
+	}
+	r := &route{
+		method:   method,
+		pattern:  pattern,
+		segments: segments,
+		handler:  handler,
+	}
+	for _, existing := range rt.routes {
+		if existing.method == method && samePattern(existing.segments, segments) {
+			panic(fmt.Sprintf("router: %s %s conflicts with %s", method, pattern, existing.pattern))
+		}
+	}
+	rt.routes = append(rt.routes, r)
+}
+
+// Serve is a server.Handler.
+func (rt *Router) Serve(w *response.Writer, req *request.Request) {
+	// Only routes accepting the method compete on specificity; the others
+	// just contribute to the Allow header of a 405.
+	var best *route
+	var values map[string]string
+	var allowed []string
+	pathMatched := false
+	for _, r := range rt.routes {
+		v, ok := r.match(req.URL.Segments)
+		if !ok {
+			continue
+		}
+		pathMatched = true
+		if r.method != req.RequestLine.Method && r.method != AnyMethod {
+			allowed = append(allowed, r.method)
+			continue
+		}
+		if best == nil || r.beats(best) {
+			best = r
+			values = v
+		}
+	}
+	if best == nil && !pathMatched {
+		writeError(w, response.StatusNotFound, "")
+		return
+	}
+	if best == nil {
+		sort.Strings(allowed)
+		writeError(w, response.StatusMethodNotAllowed, strings.Join(slices.Compact(allowed), ", "))
+		return
+	}
+
+	for name, value := range values {
+		req.SetPathValue(name, value)
+	}
+	best.handler(w, req)
+}
+
+// beats reports whether r should serve a request both r and other accept.
+func (r *route) beats(other *route) bool {
+	if moreSpecific(r.segments, other.segments) {
+		return true
+	}
+	if moreSpecific(other.segments, r.segments) {
+		return false
+	}
+	return other.method == AnyMethod && r.method != AnyMethod
+}
+
+func (r *route) match(pathSegments []string) (map[string]string, bool) {
+	values := map[string]string{}
+	for i, seg := range r.segments {
+		if seg.kind == segmentWildcard {
+			values[seg.value] = strings.Join(pathSegments[i:], "/")
+			return values, true
+		}
+		if i >= len(pathSegments) {
+			return nil, false
+		}
+		switch seg.kind {
+		case segmentLiteral:
+			if pathSegments[i] != seg.value {
+				return nil, false
+			}
+		case segmentParam:
+			values[seg.value] = pathSegments[i]
+		}
+	}
+	if len(pathSegments) != len(r.segments) {
+		return nil, false
+	}
+	return values, true
+}
+
+func parsePattern(pattern string) ([]segment, error) {
+	if !strings.HasPrefix(pattern, "/") {
+		return nil, fmt.Errorf("pattern %q must start with /", pattern)
+	}
+	trimmed := strings.TrimPrefix(pattern, "/")
+	if trimmed == "" {
+		return nil, nil
+	}
+
+	var segments []segment
+	names := map[string]bool{}
+	parts := strings.Split(trimmed, "/")
+	for i, part := range parts {
+		if !strings.HasPrefix(part, "{") || !strings.HasSuffix(part, "}") {
+			if strings.ContainsAny(part, "{}") {
+				return nil, fmt.Errorf("pattern %q: bad segment %q", pattern, part)
+			}
+			segments = append(segments, segment{kind: segmentLiteral, value: part})
+			continue
+		}
+
+		name := part[1 : len(part)-1]
+		kind := segmentParam
+		if strings.HasSuffix(name, "...") {
+			if i != len(parts)-1 {
+				return nil, fmt.Errorf("pattern %q: %s must be the last segment", pattern, part)
+			}
+			name = strings.TrimSuffix(name, "...")
+			kind = segmentWildcard
+		}
+		if name == "" || strings.ContainsAny(name, "{}.") {
+			return nil, fmt.Errorf("pattern %q: bad parameter %q", pattern, part)
+		}
+		if names[name] {
+			return nil, fmt.Errorf("pattern %q: duplicate parameter %q", pattern, name)
+		}
+		names[name] = true
+		segments = append(segments, segment{kind: kind, value: name})
+	}
+	return segments, nil
+}
+
+// moreSpecific compares patterns segment by segment; at the first difference
+// the more specific kind wins, and otherwise the longer pattern does.
+func moreSpecific(a, b []segment) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i].kind != b[i].kind {
+			return a[i].kind < b[i].kind
+		}
+	}
+	if len(a) != len(b) {
+		return len(a) > len(b)
+	}
+	return false
+}
+
+func samePattern(a, b []segment) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].kind != b[i].kind {
+			return false
+		}
+		if a[i].kind == segmentLiteral && a[i].value != b[i].value {
+			return false
+		}
+	}
+	return true
+}
+
+func writeError(w *response.Writer, code response.StatusCode, allow string) {
+	title := response.StatusText(code)
+	body := []byte(fmt.Sprintf(`<html>
+	<head>
+		<title>%d %s</title>
+	</head>
+	<body>
+		<h1>%s</h1>
+	</body>
+</html>`, code, title, title))
+	w.WriteStatusLine(code)
+	w.Header = response.GetDefaultHeaders(len(body))
+	w.Header.Override("Content-Type", "text/html")
+	if allow != "" {
+		w.Header.Override("Allow", allow)
+	}
+	w.WriteHeaders()
+	w.WriteBody(body)
+}
@@ -0,0 +1,109 @@
+package router
+
+import (
+	"bytes"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serve(t *testing.T, rt *Router, method, target string) string {
+	t.Helper()
+	req, err := request.RequestFromReader(strings.NewReader(method + " " + target + " HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	buf := &bytes.Buffer{}
+	w := response.NewWriter(buf)
+	rt.Serve(w, req)
+	require.NoError(t, w.Finish())
+	return buf.String()
+}
+
+func named(name string) func(w *response.Writer, req *request.Request) {
+	return func(w *response.Writer, req *request.Request) {
+		body := []byte(name + " id=" + req.PathValue("id") + " rest=" + req.PathValue("rest"))
+		w.WriteStatusLine(response.StatusOK)
+		w.Header = response.GetDefaultHeaders(len(body))
+		w.WriteHeaders()
+		w.WriteBody(body)
+	}
+}
+
+func TestRouter(t *testing.T) {
+	rt := New()
+	rt.Handle("GET", "/", named("root"))
+	rt.Handle("GET", "/users/{id}", named("user"))
+	rt.Handle("PUT", "/users/{id}", named("put-user"))
+	rt.Handle("GET", "/users/me", named("me"))
+	rt.Handle(AnyMethod, "/httpbin/{rest...}", named("proxy"))
+	rt.Handle("GET", "/httpbin/special", named("special"))
+	rt.Handle(AnyMethod, "/any", named("any"))
+	rt.Handle("POST", "/any", named("post-any"))
+
+	// Test: Root and literal routes
+	assert.Contains(t, serve(t, rt, "GET", "/"), "root")
+	assert.Contains(t, serve(t, rt, "GET", "/users/me"), "me id=")
+
+	// Test: Path parameters
+	assert.Contains(t, serve(t, rt, "GET", "/users/42"), "user id=42")
+	assert.Contains(t, serve(t, rt, "PUT", "/users/42"), "put-user id=42")
+	assert.Contains(t, serve(t, rt, "GET", "/users/a%20b"), "user id=a b")
+
+	// Test: Wildcard suffix
+	assert.Contains(t, serve(t, rt, "GET", "/httpbin/stream/10"), "proxy id= rest=stream/10")
+	assert.Contains(t, serve(t, rt, "POST", "/httpbin/post"), "proxy id= rest=post")
+	assert.Contains(t, serve(t, rt, "GET", "/httpbin"), "proxy id= rest=")
+
+	// Test: Literals beat wildcards, method-specific beats any method
+	assert.Contains(t, serve(t, rt, "GET", "/httpbin/special"), "special")
+	assert.Contains(t, serve(t, rt, "POST", "/any"), "post-any")
+	assert.Contains(t, serve(t, rt, "DELETE", "/any"), "any id=")
+
+	// Test: Not found
+	resp := serve(t, rt, "GET", "/nope")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 404 Not Found\r\n"))
+	resp = serve(t, rt, "GET", "/users/42/posts")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 404 Not Found\r\n"))
+
+	// Test: Method not allowed lists registered methods
+	resp = serve(t, rt, "DELETE", "/users/42")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 405 Method Not Allowed\r\n"))
+	assert.Contains(t, resp, "Allow: GET, PUT\r\n")
+
+	// Test: A less specific route accepting the method wins over a more
+	// specific one that doesn't
+	rt = New()
+	rt.Handle("GET", "/users/{id}", named("user"))
+	rt.Handle("POST", "/users/me", named("post-me"))
+	assert.Contains(t, serve(t, rt, "GET", "/users/me"), "user id=me")
+	assert.Contains(t, serve(t, rt, "POST", "/users/me"), "post-me")
+	rt.Handle(AnyMethod, "/{path...}", named("default"))
+	assert.Contains(t, serve(t, rt, "GET", "/users/me"), "user id=me")
+	assert.Contains(t, serve(t, rt, "DELETE", "/users/me"), "default")
+
+	// Test: Allow lists the methods of every pattern matching the path
+	rt = New()
+	rt.Handle("GET", "/users/{id}", named("user"))
+	rt.Handle("PUT", "/users/{id}", named("put-user"))
+	rt.Handle("POST", "/users/me", named("post-me"))
+	rt.Handle("GET", "/users/me", named("me"))
+	resp = serve(t, rt, "DELETE", "/users/me")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 405 Method Not Allowed\r\n"))
+	assert.Contains(t, resp, "Allow: GET, POST, PUT\r\n")
+}
+
+func TestRouterBadPatterns(t *testing.T) {
+	rt := New()
+	assert.Panics(t, func() { rt.Handle("GET", "users", named("x")) })
+	assert.Panics(t, func() { rt.Handle("GET", "/{rest...}/more", named("x")) })
+	assert.Panics(t, func() { rt.Handle("GET", "/{id}/{id}", named("x")) })
+	assert.Panics(t, func() { rt.Handle("GET", "/{}", named("x")) })
+	assert.Panics(t, func() { rt.Handle("GET", "/a{b}", named("x")) })
+
+	rt.Handle("GET", "/users/{id}", named("x"))
+	assert.Panics(t, func() { rt.Handle("GET", "/users/{name}", named("y")) })
+	assert.NotPanics(t, func() { rt.Handle("POST", "/users/{name}", named("y")) })
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"time"
+)
+
+const defaultMaxPipelineDepth = 16
+
+type Config struct {
+	// MaxPipelineDepth bounds how many requests on one connection may be
+	// parsed ahead of the response currently being written.
+	MaxPipelineDepth int
+	// Limits bounds the size of each request; zero fields use the request
+	// package defaults.
+	Limits request.Limits
+
+	// ReadHeaderTimeout bounds the time from the first byte of a request
+	// to the end of its headers. Zero falls back to ReadTimeout.
+	ReadHeaderTimeout time.Duration
+	// ReadTimeout bounds reading a whole request, body included.
+	ReadTimeout time.Duration
+	// WriteTimeout bounds writing a response, starting when the handler is
+	// called.
+	WriteTimeout time.Duration
+	// IdleTimeout bounds how long a keep-alive connection waits for the next
+	// request. Zero falls back to ReadTimeout.
+	IdleTimeout time.Duration
+	// HandlerTimeout, if set, cancels each request's context after it
+	// elapses. Handlers have to watch the context to stop early.
+	HandlerTimeout time.Duration
+
+	// ResponseBufferBytes is how much of a body written without a
+	// Content-Length is held back so one can be computed; longer bodies are
+	// sent chunked. Zero uses response.DefaultBufferThreshold and a negative
+	// value disables buffering.
+	ResponseBufferBytes int
+
+	// ErrorHandler writes the responses the server generates itself: for
+	// requests that could not be parsed and for handlers that panicked. The
+	// connection is closed afterwards. Nil uses a built-in HTML page.
+	ErrorHandler ErrorHandler
+	// PanicHandler, if set, is called with every panic recovered from a
+	// handler, e.g. to report it to an error tracker.
+	PanicHandler PanicHandler
+}
+
+func (c Config) maxPipelineDepth() int {
+	if c.MaxPipelineDepth <= 0 {
+		return defaultMaxPipelineDepth
+	}
+	return c.MaxPipelineDepth
+}
+
+func (c Config) readHeaderTimeout() time.Duration {
+	if c.ReadHeaderTimeout <= 0 {
+		return c.ReadTimeout
+	}
+	return c.ReadHeaderTimeout
+}
+
+func (c Config) idleTimeout() time.Duration {
+	if c.IdleTimeout <= 0 {
+		return c.ReadTimeout
+	}
+	return c.IdleTimeout
+}
+
+func (c Config) responseBufferBytes() int {
+	if c.ResponseBufferBytes == 0 {
+		return response.DefaultBufferThreshold
+	}
+	return c.ResponseBufferBytes
+}
+
+func (c Config) errorHandler() ErrorHandler {
+	if c.ErrorHandler == nil {
+		return defaultErrorHandler
+	}
+	return c.ErrorHandler
+}
@@ -0,0 +1,38 @@
+package server
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+)
+
+// conn is a connection tracked by the server so Shutdown can tell idle
+// keep-alive connections from ones with requests still in flight.
+type conn struct {
+	net.Conn
+	timeouts *connTimeouts
+	// pending counts requests parsed but not yet answered.
+	pending atomic.Int32
+	// ctx is cancelled once the peer disconnects or the connection is done.
+	ctx    context.Context
+	cancel context.CancelFunc
+	// hijacked is set once a handler has taken the connection over.
+	hijacked atomic.Bool
+}
+
+func newConn(baseCtx context.Context, netConn net.Conn, config Config) *conn {
+	ctx, cancel := context.WithCancel(baseCtx)
+	return &conn{
+		Conn:     netConn,
+		timeouts: newConnTimeouts(netConn, config),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// isIdle reports whether the connection is waiting for a new request with
+// nothing left to answer. The reader counts a request as pending before it
+// goes back to waiting, so a request can't slip between the two checks.
+func (c *conn) isIdle() bool {
+	return c.pending.Load() == 0 && c.timeouts.isIdle()
+}
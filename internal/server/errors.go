@@ -0,0 +1,48 @@
+package server
+
+import (
+	"fmt"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+)
+
+var errorMessages = map[response.StatusCode]string{
+	response.StatusBadRequest:                  "Your request honestly kinda sucked.",
+	response.StatusRequestTimeout:              "We got tired of waiting for you.",
+	response.StatusLengthRequired:              "How long is it, though?",
+	response.StatusContentTooLarge:             "That body is more than we can take.",
+	response.StatusURITooLong:                  "That request line just kept going.",
+	response.StatusRequestHeaderFieldsTooLarge: "That is way too many headers.",
+	response.StatusInternalServerError:         "Okay, you know what? This one is on me.",
+	response.StatusNotImplemented:              "We haven't gotten around to that one.",
+	response.StatusHTTPVersionNotSupported:     "Try speaking HTTP/1.1.",
+}
+
+func parseErrorStatus(err error) response.StatusCode {
+	if isTimeout(err) {
+		return response.StatusRequestTimeout
+	}
+	return response.StatusCode(request.StatusCode(err))
+}
+
+func defaultErrorHandler(w *response.Writer, statusCode response.StatusCode, err error) {
+	title := response.StatusText(statusCode)
+	message, ok := errorMessages[statusCode]
+	if !ok {
+		message = err.Error()
+	}
+	body := []byte(fmt.Sprintf(`<html>
+						<head>
+							<title>%d %s</title>
+						</head>
+						<body>
+							<h1>%s</h1>
+							<p>%s</p>
+						</body>
+						</html>`, statusCode, title, title, message))
+	w.WriteStatusLine(statusCode)
+	w.Header = response.GetDefaultHeaders(len(body))
+	w.Header.Override("Content-Type", "text/html")
+	w.WriteHeaders()
+	w.WriteBody(body)
+}
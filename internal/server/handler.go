@@ -5,4 +5,8 @@ import (
 	"httpfromtcp/internal/response"
 )
 
-type Handler func(w *response.Writer, req *request.Request)
\ No newline at end of file
+type Handler func(w *response.Writer, req *request.Request)
+
+type ErrorHandler func(w *response.Writer, statusCode response.StatusCode, err error)
+
+type PanicHandler func(req *request.Request, recovered any, stack []byte)
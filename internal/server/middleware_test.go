@@ -0,0 +1,84 @@
+package server
+
+import (
+	"bytes"
+	"httpfromtcp/internal/headers"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func tag(name string, calls *[]string) Middleware {
+	return func(next Handler) Handler {
+		return func(w *response.Writer, req *request.Request) {
+			*calls = append(*calls, name+" before")
+			next(w, req)
+			*calls = append(*calls, name+" after")
+		}
+	}
+}
+
+func TestChain(t *testing.T) {
+	var calls []string
+	handler := func(w *response.Writer, req *request.Request) {
+		calls = append(calls, "handler")
+	}
+
+	base := NewChain(tag("a", &calls), tag("b", &calls))
+	extended := base.Append(tag("c", &calls))
+
+	base.Then(handler)(nil, nil)
+	assert.Equal(t, []string{"a before", "b before", "handler", "b after", "a after"}, calls)
+
+	calls = nil
+	extended.Then(handler)(nil, nil)
+	assert.Equal(t, []string{"a before", "b before", "c before", "handler", "c after", "b after", "a after"}, calls)
+
+	calls = nil
+	NewChain().Then(handler)(nil, nil)
+	assert.Equal(t, []string{"handler"}, calls)
+}
+
+func TestMiddlewareObservesResponse(t *testing.T) {
+	var status response.StatusCode
+	var contentType string
+	var body []byte
+	observe := func(next Handler) Handler {
+		return func(w *response.Writer, req *request.Request) {
+			w.AddHooks(response.Hooks{
+				WriteHeaders: func(code response.StatusCode, h headers.Headers) {
+					status = code
+					contentType = h.Get("Content-Type")
+				},
+				WriteBody: func(p []byte) {
+					body = append(body, p...)
+				},
+			})
+			next(w, req)
+		}
+	}
+	handler := func(w *response.Writer, req *request.Request) {
+		w.WriteStatusLine(response.StatusOK)
+		w.Header.Set("Content-Type", "text/plain")
+		w.Header.Set("Transfer-Encoding", "chunked")
+		w.WriteHeaders()
+		w.WriteChunkedBody([]byte("hello "))
+		w.WriteChunkedBody([]byte("world"))
+		w.WriteChunkedBodyDone()
+	}
+
+	req, err := request.RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\n\r\n"))
+	require.NoError(t, err)
+	w := response.NewWriter(&bytes.Buffer{})
+	NewChain(observe).Then(handler)(w, req)
+
+	assert.Equal(t, response.StatusOK, status)
+	assert.Equal(t, "text/plain", contentType)
+	assert.Equal(t, "hello world", string(body))
+	assert.Equal(t, response.StatusOK, w.Status())
+	assert.Equal(t, int64(11), w.BytesWritten())
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServeKeepAliveAndPipelining(t *testing.T) {
+	handler := func(w *response.Writer, req *request.Request) {
+		body, _ := io.ReadAll(req.Body)
+		writeText(w, req.URL.Path+":"+string(body))
+	}
+	out := serveConn(t, handler, Config{},
+		"GET /a HTTP/1.1\r\n\r\n"+
+			"POST /b HTTP/1.1\r\nContent-Length: 3\r\n\r\nxyz"+
+			"GET /c HTTP/1.1\r\nConnection: close\r\n\r\n"+
+			"GET /ignored HTTP/1.1\r\n\r\n")
+
+	assert.Equal(t, 3, strings.Count(out, "HTTP/1.1 200 OK"))
+	a := strings.Index(out, "/a:")
+	b := strings.Index(out, "/b:xyz")
+	c := strings.Index(out, "/c:")
+	assert.True(t, a >= 0 && a < b && b < c, "responses out of order: %q", out)
+	assert.NotContains(t, out, "/ignored")
+	assert.Contains(t, out, "Connection: close\r\n")
+}
+
+func TestServePipelineDepth(t *testing.T) {
+	// Test: While a handler runs, at most MaxPipelineDepth requests are
+	// parsed, the running one included
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handler := func(w *response.Writer, req *request.Request) {
+		if req.URL.Path == "/1" {
+			close(started)
+			<-release
+		}
+		writeText(w, req.URL.Path)
+	}
+	client, c := startConn(t, handler, Config{MaxPipelineDepth: 2})
+	go client.Write([]byte("GET /1 HTTP/1.1\r\n\r\n" +
+		"GET /2 HTTP/1.1\r\n\r\n" +
+		"GET /3 HTTP/1.1\r\n\r\n" +
+		"GET /4 HTTP/1.1\r\nConnection: close\r\n\r\n"))
+
+	<-started
+	assert.Eventually(t, func() bool { return c.pending.Load() == 2 }, time.Second, 5*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int32(2), c.pending.Load())
+	close(release)
+
+	client.SetReadDeadline(time.Now().Add(2 * time.Second))
+	out, err := io.ReadAll(client)
+	require.NoError(t, err)
+	assert.Equal(t, 4, strings.Count(string(out), "HTTP/1.1 200 OK"))
+	assert.True(t, strings.HasSuffix(string(out), "/4"), string(out))
+}
+
+func TestServeBodyStopsParseAhead(t *testing.T) {
+	// Test: The request after one with a body is only parsed once that
+	// handler has returned, even if it already read the whole body
+	bodies := make(chan string)
+	release := make(chan struct{})
+	handler := func(w *response.Writer, req *request.Request) {
+		if req.URL.Path == "/upload" {
+			body, _ := io.ReadAll(req.Body)
+			bodies <- string(body)
+			<-release
+		}
+		writeText(w, req.URL.Path)
+	}
+	client, c := startConn(t, handler, Config{})
+	go client.Write([]byte("POST /upload HTTP/1.1\r\nContent-Length: 3\r\n\r\nabc" +
+		"GET /next HTTP/1.1\r\nConnection: close\r\n\r\n"))
+
+	assert.Equal(t, "abc", <-bodies)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int32(1), c.pending.Load())
+	close(release)
+
+	client.SetReadDeadline(time.Now().Add(2 * time.Second))
+	out, err := io.ReadAll(client)
+	require.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(string(out), "HTTP/1.1 200 OK"))
+	assert.True(t, strings.HasSuffix(string(out), "/next"), string(out))
+}
@@ -1,28 +1,54 @@
 package server
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"httpfromtcp/internal/headers"
 	"httpfromtcp/internal/request"
 	"httpfromtcp/internal/response"
+	"io"
 	"log"
 	"net"
+	"runtime/debug"
+	"sync"
 	"sync/atomic"
+	"time"
 )
 
 type Server struct {
 	listener net.Listener
 	closed atomic.Bool
+	inShutdown atomic.Bool
 	handler Handler
+	config Config
+
+	mu sync.Mutex
+	conns map[*conn]struct{}
+
+	// baseCtx is the parent of every request context and is cancelled when
+	// Shutdown gives up waiting and closes connections forcibly.
+	baseCtx context.Context
+	cancelBase context.CancelFunc
 }
 
 func Serve(port int, handler Handler) (*Server, error) {
+	return ServeWithConfig(port, handler, Config{})
+}
+
+func ServeWithConfig(port int, handler Handler, config Config) (*Server, error) {
 	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
 	if err != nil {
 		return nil, err
 	}
+	baseCtx, cancelBase := context.WithCancel(context.Background())
 	s := &Server{
 		listener: ln,
 		handler: handler,
+		config: config,
+		conns: make(map[*conn]struct{}),
+		baseCtx: baseCtx,
+		cancelBase: cancelBase,
 	}
 	go s.listen()
 	return s, nil
@@ -33,9 +59,32 @@ func (s *Server) Close() error {
 	return s.listener.Close()
 }
 
+// Shutdown stops accepting connections, closes idle ones and waits for the
+// rest to finish their in-flight requests. Connections still open when ctx is
+// done are closed forcibly and ctx's error is returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.inShutdown.Store(true)
+	err := s.Close()
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for {
+		if s.closeIdleConns() {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			s.cancelBase()
+			s.closeAllConns()
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
 func (s *Server) listen() {
 	for {
-		conn, err := s.listener.Accept()
+		netConn, err := s.listener.Accept()
 		if err != nil {
 			if s.closed.Load() {
 				return
@@ -43,31 +92,318 @@ func (s *Server) listen() {
 			log.Printf("Accept error: %v", err)
 			continue
 		}
-		go s.handle(conn)
+		c := newConn(s.baseCtx, netConn, s.config)
+		s.trackConn(c, true)
+		go s.handle(c)
+	}
+}
+
+func (s *Server) trackConn(c *conn, add bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if add {
+		s.conns[c] = struct{}{}
+	} else {
+		delete(s.conns, c)
+	}
+}
+
+// closeIdleConns reports whether no connections are left afterwards.
+func (s *Server) closeIdleConns() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.conns {
+		if c.isIdle() {
+			c.Close()
+			delete(s.conns, c)
+		}
 	}
+	return len(s.conns) == 0
 }
 
-func (s *Server) handle(conn net.Conn) {
-	defer conn.Close()
+func (s *Server) closeAllConns() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.conns {
+		c.Close()
+		delete(s.conns, c)
+	}
+}
+
+const shutdownPollInterval = 50 * time.Millisecond
+
+// Unread request bodies up to this size are discarded so the connection can
+// be reused; anything larger closes the connection instead.
+const maxDrainBytes = 256 << 10
+
+type parsedRequest struct {
+	req *request.Request
+	err error
+	// release is closed once the handler no longer needs the connection's
+	// input, i.e. the body has been consumed and the connection wasn't
+	// hijacked, letting the reader parse the next request.
+	release chan struct{}
+}
+
+func (s *Server) handle(conn *conn) {
+	defer s.trackConn(conn, false)
+	defer func() {
+		if !conn.hijacked.Load() {
+			conn.Close()
+		}
+	}()
+	defer conn.cancel()
+
+	// Requests are parsed ahead by a separate goroutine while the handler for
+	// an earlier one runs. Handlers still run one at a time in arrival order,
+	// so responses go out in the order the requests came in.
+	depth := s.config.maxPipelineDepth()
+	requests := make(chan parsedRequest, depth)
+	slots := make(chan struct{}, depth)
+	done := make(chan struct{})
+	defer close(done)
+	reader := request.NewReaderWithLimits(conn.timeouts, s.config.Limits)
+	go readRequests(reader, conn, requests, slots, done)
+
+	for pr := range requests {
+		if pr.err != nil {
+			if pr.err != io.EOF {
+				conn.SetWriteDeadline(deadline(time.Now(), s.config.WriteTimeout))
+				writer := response.NewWriter(conn)
+				writer.SetConnectionClose()
+				s.config.errorHandler()(writer, parseErrorStatus(pr.err), pr.err)
+				writer.Finish()
+			}
+			return
+		}
 
-	req, err := request.RequestFromReader(conn)
-	if err != nil {
 		writer := response.NewWriter(conn)
-		writer.WriteStatusLine(response.StatusBadRequest)
-		writer.Header.Set("Content-Type", "text/html")
-		writer.WriteHeaders()
-		writer.WriteBody([]byte(`<html>
-									<head>
-										<title>400 Bad Request</title>
-									</head>
-									<body>
-										<h1>Bad Request</h1>
-										<p>Your request honestly kinda sucked.</p>
-									</body>
-									</html>`))
+		writer.SetHttpVersion(pr.req.RequestLine.HttpVersion)
+		writer.SetRequestMethod(pr.req.RequestLine.Method)
+		writer.SetBufferThreshold(s.config.responseBufferBytes())
+		if mayTakeOver(pr.req) {
+			writer.SetHijacker(s.hijacker(conn, reader))
+		}
+		if !pr.req.KeepAlive() || s.inShutdown.Load() {
+			writer.SetConnectionClose()
+		}
+		writer.AddHooks(s.closeOnShutdown())
+		conn.timeouts.handlerStarted()
+		ok := s.serveRequest(conn, writer, pr.req)
+		if writer.Hijacked() {
+			return
+		}
+		if ok {
+			if err := writer.Finish(); err != nil {
+				s.replaceWithError(conn, writer, err)
+				ok = false
+			}
+		}
+		pr.req.Body.Close()
+		conn.timeouts.handlerDone()
+		conn.pending.Add(-1)
+
+		if !ok || writer.ConnectionClose() || s.inShutdown.Load() || !pr.req.DrainBody(maxDrainBytes) {
+			return
+		}
+		if pr.release != nil {
+			close(pr.release)
+		}
+		<-slots
+	}
+}
+
+// serveRequest runs the handler with a context that ends when the peer goes
+// away, the server is shut down forcibly, the handler timeout elapses or the
+// handler returns. It reports false if the handler panicked, in which case
+// the connection must not be reused.
+func (s *Server) serveRequest(conn *conn, w *response.Writer, req *request.Request) (ok bool) {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+	if s.config.HandlerTimeout > 0 {
+		ctx, cancel = context.WithTimeout(conn.ctx, s.config.HandlerTimeout)
+	} else {
+		ctx, cancel = context.WithCancel(conn.ctx)
+	}
+	defer cancel()
+	req = req.WithContext(ctx)
+
+	defer func() {
+		recovered := recover()
+		if recovered == nil {
+			return
+		}
+		ok = false
+		stack := debug.Stack()
+		log.Printf("panic serving %s %s: %v\n%s", req.RequestLine.Method, req.RequestLine.RequestTarget, recovered, stack)
+		if s.config.PanicHandler != nil {
+			s.config.PanicHandler(req, recovered, stack)
+		}
+
+		s.replaceWithError(conn, w, fmt.Errorf("panic: %v", recovered))
+	}()
+
+	s.handler(w, req)
+	return true
+}
+
+// closeOnShutdown announces Connection: close on responses whose headers go
+// out after Shutdown began, so a client doesn't send another request on a
+// connection about to be closed.
+func (s *Server) closeOnShutdown() response.Hooks {
+	return response.Hooks{
+		WriteHeaders: func(code response.StatusCode, h headers.Headers) {
+			if s.inShutdown.Load() && code != response.StatusSwitchingProtocols {
+				h.Override("Connection", "close")
+			}
+		},
+	}
+}
+
+// replaceWithError answers with a 500 in place of a response the handler
+// failed to complete. Once part of the response is out there is no way to
+// signal the error in-band, so the client only sees the connection drop.
+// Output still buffered is discarded either way.
+func (s *Server) replaceWithError(conn *conn, w *response.Writer, err error) {
+	if w.Hijacked() || w.Reset() != nil {
+		conn.Close()
 		return
 	}
+	w.SetConnectionClose()
+	s.config.errorHandler()(w, response.StatusInternalServerError, err)
+	w.Finish()
+}
+
+// readRequests takes a slot before parsing each request so that at most depth
+// requests are held in memory waiting for their responses.
+func readRequests(reader *request.Reader, conn *conn, requests chan<- parsedRequest, slots chan<- struct{}, done <-chan struct{}) {
+	defer close(requests)
+
+	for {
+		select {
+		case slots <- struct{}{}:
+		case <-done:
+			return
+		}
+
+		conn.timeouts.waitForRequest(reader.Buffered() > 0)
+		req, err := reader.ReadRequest()
+		if err == nil {
+			conn.timeouts.headersRead()
+			conn.pending.Add(1)
+		} else if isTimeout(err) && conn.timeouts.isIdle() {
+			err = io.EOF
+		}
+		if isDisconnect(err) {
+			conn.cancel()
+		}
+		pr := parsedRequest{req: req, err: err}
+		if err == nil && (req.ContentLength != 0 || mayTakeOver(req)) {
+			pr.release = make(chan struct{})
+		}
+		select {
+		case requests <- pr:
+		case <-done:
+			return
+		}
+		if err != nil {
+			return
+		}
+		if !req.KeepAlive() {
+			if mayTakeOver(req) {
+				return
+			}
+			if pr.release != nil {
+				select {
+				case <-req.BodyDone():
+				case <-done:
+					return
+				}
+			}
+			watchForDisconnect(conn)
+			return
+		}
+
+		// The body is read from the connection by the handler, and the
+		// handler may take the connection over entirely, so parsing can only
+		// continue once it is done with it. Once the body has been read the
+		// connection can still be watched for a hang-up.
+		if pr.release != nil {
+			if !mayTakeOver(req) {
+				select {
+				case <-req.BodyDone():
+					if !peekNextRequest(reader, conn) {
+						return
+					}
+				case <-pr.release:
+				case <-done:
+					return
+				}
+			}
+			select {
+			case <-pr.release:
+			case <-done:
+				return
+			}
+		}
+	}
+}
+
+// peekNextRequest waits for the start of the next request while the handler
+// for the current one may still be running, so a client hanging up cancels
+// the request context. What arrives is kept and only parsed once the handler
+// is done. It reports false if the connection ended meanwhile.
+func peekNextRequest(reader *request.Reader, conn *conn) bool {
+	if reader.Buffered() > 0 {
+		return true
+	}
+	conn.timeouts.waitForRequest(false)
+	err := reader.Peek()
+	if isDisconnect(err) {
+		conn.cancel()
+	}
+	return err == nil
+}
 
-	writer := response.NewWriter(conn)
-	s.handler(writer, req)
-}
\ No newline at end of file
+// mayTakeOver reports whether the handler may hijack the connection for
+// another protocol, so nothing after the request may be parsed as HTTP.
+func mayTakeOver(req *request.Request) bool {
+	return req.RequestLine.Method == "CONNECT" || req.Headers.HasToken("Connection", "upgrade")
+}
+
+// hijacker hands the connection over with whatever the reader buffered past
+// the request. The connection is no longer tracked, so Shutdown neither waits
+// for nor closes it.
+func (s *Server) hijacker(c *conn, reader *request.Reader) response.HijackFunc {
+	return func() (net.Conn, []byte, error) {
+		if err := c.SetDeadline(time.Time{}); err != nil {
+			return nil, nil, err
+		}
+		c.hijacked.Store(true)
+		s.trackConn(c, false)
+		return c.Conn, reader.Detach(), nil
+	}
+}
+
+// isDisconnect reports whether a read error means the peer is gone rather
+// than that it sent something unparsable.
+func isDisconnect(err error) bool {
+	var reqErr *request.Error
+	return err != nil && !errors.As(err, &reqErr) && !isTimeout(err)
+}
+
+// watchForDisconnect keeps reading after the last request on a connection so
+// the request context is cancelled if the client hangs up mid-response. Any
+// bytes sent after that request are discarded.
+func watchForDisconnect(conn *conn) {
+	conn.SetReadDeadline(time.Time{})
+	buf := make([]byte, 512)
+	for {
+		if _, err := conn.Read(buf); err != nil {
+			conn.cancel()
+			return
+		}
+	}
+}
@@ -0,0 +1,278 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serveConn runs handler on one end of an in-memory connection, sends raw to
+// it and returns everything written back until the server closes it.
+func serveConn(t *testing.T, handler Handler, config Config, raw string) string {
+	t.Helper()
+	client, _ := startConn(t, handler, config)
+	go client.Write([]byte(raw))
+	client.SetReadDeadline(time.Now().Add(2 * time.Second))
+	out, err := io.ReadAll(client)
+	require.NoError(t, err)
+	return string(out)
+}
+
+// startConn serves one end of an in-memory connection and returns the other
+// end along with the server's side of it.
+func startConn(t *testing.T, handler Handler, config Config) (net.Conn, *conn) {
+	t.Helper()
+	baseCtx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	s := &Server{
+		handler:    handler,
+		config:     config,
+		conns:      make(map[*conn]struct{}),
+		baseCtx:    baseCtx,
+		cancelBase: cancel,
+	}
+
+	client, serverSide := net.Pipe()
+	t.Cleanup(func() { client.Close() })
+	c := newConn(baseCtx, serverSide, config)
+	s.trackConn(c, true)
+	go s.handle(c)
+	return client, c
+}
+
+func writeText(w *response.Writer, text string) {
+	w.WriteStatusLine(response.StatusOK)
+	w.Header = response.GetDefaultHeaders(len(text))
+	w.WriteHeaders()
+	w.WriteBody([]byte(text))
+}
+
+func TestServeRecoversPanics(t *testing.T) {
+	var hookValue any
+	var hookStack []byte
+	config := Config{
+		PanicHandler: func(req *request.Request, recovered any, stack []byte) {
+			hookValue = recovered
+			hookStack = stack
+		},
+	}
+
+	// Test: Panic before anything was written sends a 500
+	handler := func(w *response.Writer, req *request.Request) {
+		panic("boom")
+	}
+	out := serveConn(t, handler, config, "GET / HTTP/1.1\r\n\r\nGET /next HTTP/1.1\r\n\r\n")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 500 Internal Server Error\r\n"), out)
+	assert.Contains(t, out, "Connection: close\r\n")
+	assert.Equal(t, 1, strings.Count(out, "HTTP/1.1"))
+	assert.Equal(t, "boom", hookValue)
+	assert.Contains(t, string(hookStack), "TestServeRecoversPanics")
+
+	// Test: Output still buffered at the panic is replaced by the 500
+	handler = func(w *response.Writer, req *request.Request) {
+		fmt.Fprint(w, "partial")
+		panic("early boom")
+	}
+	out = serveConn(t, handler, config, "GET / HTTP/1.1\r\n\r\n")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 500 Internal Server Error\r\n"), out)
+	assert.NotContains(t, out, "partial")
+	assert.Equal(t, 1, strings.Count(out, "HTTP/1.1"))
+	assert.Equal(t, "early boom", hookValue)
+
+	// Test: Panic after part of the response was sent aborts the connection
+	// without flushing the rest
+	handler = func(w *response.Writer, req *request.Request) {
+		fmt.Fprint(w, "partial")
+		w.Flush()
+		fmt.Fprint(w, "unsent")
+		panic("late boom")
+	}
+	out = serveConn(t, handler, config, "GET / HTTP/1.1\r\n\r\n")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 200 OK\r\n"), out)
+	assert.True(t, strings.HasSuffix(out, "7\r\npartial\r\n"), out)
+	assert.NotContains(t, out, "500")
+	assert.Equal(t, "late boom", hookValue)
+}
+
+func TestServeInvalidHeaders(t *testing.T) {
+	// The 500 the client should get in place of the broken response.
+	buf := &bytes.Buffer{}
+	want := response.NewWriter(buf)
+	want.SetConnectionClose()
+	defaultErrorHandler(want, response.StatusInternalServerError, nil)
+	require.NoError(t, want.Finish())
+	require.True(t, strings.HasPrefix(buf.String(), "HTTP/1.1 500 Internal Server Error\r\n"))
+
+	// Test: Headers rejected by validation are replaced by a 500, with
+	// the explicit API and with Write
+	handlers := map[string]Handler{
+		"explicit": func(w *response.Writer, req *request.Request) {
+			w.WriteStatusLine(response.StatusOK)
+			w.Header.Set("X-Foo", "a\r\nb")
+			w.WriteHeaders()
+			w.WriteBody([]byte("body"))
+		},
+		"implicit": func(w *response.Writer, req *request.Request) {
+			w.Header.Set("X-Foo", "a\r\nb")
+			fmt.Fprint(w, "body")
+		},
+	}
+	for name, handler := range handlers {
+		t.Run(name, func(t *testing.T) {
+			out := serveConn(t, handler, Config{}, "GET / HTTP/1.1\r\n\r\nGET /next HTTP/1.1\r\n\r\n")
+			assert.Equal(t, buf.String(), out)
+		})
+	}
+}
+
+func TestServeImplicitResponses(t *testing.T) {
+	handler := func(w *response.Writer, req *request.Request) {
+		switch req.URL.Path {
+		case "/print":
+			fmt.Fprintf(w, "hello %s", "world")
+		case "/copy":
+			w.Header.Set("Content-Length", "3")
+			io.Copy(w, strings.NewReader("abc"))
+		}
+	}
+	out := serveConn(t, handler, Config{},
+		"GET /print HTTP/1.1\r\n\r\n"+
+			"GET /copy HTTP/1.1\r\n\r\n"+
+			"GET /empty HTTP/1.1\r\nConnection: close\r\n\r\n")
+
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Content-Length: 11\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"\r\n"+
+		"hello world"+
+		"HTTP/1.1 200 OK\r\n"+
+		"Content-Length: 3\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"\r\n"+
+		"abc"+
+		"HTTP/1.1 200 OK\r\n"+
+		"Connection: close\r\n"+
+		"Content-Length: 0\r\n"+
+		"\r\n", out)
+}
+
+func TestServeHead(t *testing.T) {
+	// Test: The body of a HEAD response is dropped so the next response on
+	// the connection isn't corrupted
+	handler := func(w *response.Writer, req *request.Request) {
+		fmt.Fprint(w, "hello")
+	}
+	out := serveConn(t, handler, Config{},
+		"HEAD / HTTP/1.1\r\n\r\n"+
+			"GET / HTTP/1.1\r\nConnection: close\r\n\r\n")
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Content-Length: 5\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"\r\n"+
+		"HTTP/1.1 200 OK\r\n"+
+		"Connection: close\r\n"+
+		"Content-Length: 5\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"\r\n"+
+		"hello", out)
+}
+
+func TestServeResponseBufferBytes(t *testing.T) {
+	handler := func(w *response.Writer, req *request.Request) {
+		fmt.Fprint(w, "0123456789")
+	}
+	out := serveConn(t, handler, Config{ResponseBufferBytes: 4}, "GET / HTTP/1.1\r\nConnection: close\r\n\r\n")
+	assert.Contains(t, out, "Transfer-Encoding: chunked\r\n")
+	assert.True(t, strings.HasSuffix(out, "a\r\n0123456789\r\n0\r\n\r\n"), out)
+
+	out = serveConn(t, handler, Config{}, "GET / HTTP/1.1\r\nConnection: close\r\n\r\n")
+	assert.Contains(t, out, "Content-Length: 10\r\n")
+}
+
+func TestServeHijack(t *testing.T) {
+	// Test: An upgrade request hands over the connection with the bytes
+	// that followed it
+	handler := func(w *response.Writer, req *request.Request) {
+		netConn, rw, err := w.Hijack()
+		require.NoError(t, err)
+		defer netConn.Close()
+		buf := make([]byte, 5)
+		_, err = io.ReadFull(rw, buf)
+		require.NoError(t, err)
+		fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: echo\r\nConnection: Upgrade\r\n\r\n%s", strings.ToUpper(string(buf)))
+		require.NoError(t, rw.Flush())
+		_, err = w.Write([]byte("late"))
+		assert.ErrorIs(t, err, response.ErrHijacked)
+	}
+	out := serveConn(t, handler, Config{}, "GET /echo HTTP/1.1\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\nhello")
+	assert.Equal(t, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: echo\r\nConnection: Upgrade\r\n\r\nHELLO", out)
+
+	// Test: Requests the server may parse ahead of can't be hijacked
+	var hijackErr error
+	handler = func(w *response.Writer, req *request.Request) {
+		_, _, hijackErr = w.Hijack()
+	}
+	out = serveConn(t, handler, Config{}, "GET / HTTP/1.1\r\nConnection: close\r\n\r\n")
+	assert.ErrorIs(t, hijackErr, response.ErrNotHijackable)
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 200 OK\r\n"), out)
+
+	// Test: Upgrade requests that aren't hijacked keep the connection going
+	handler = func(w *response.Writer, req *request.Request) {
+		fmt.Fprint(w, req.URL.Path)
+	}
+	out = serveConn(t, handler, Config{},
+		"GET /a HTTP/1.1\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n"+
+			"GET /b HTTP/1.1\r\nConnection: close\r\n\r\n")
+	assert.Equal(t, 2, strings.Count(out, "HTTP/1.1 200 OK"))
+	assert.True(t, strings.HasSuffix(out, "/b"), out)
+}
+
+func TestServeDisconnectCancelsContext(t *testing.T) {
+	// Test: A client hanging up cancels the request context, also after
+	// sending a body the handler has already read
+	tests := []struct {
+		name string
+		raw  string
+	}{
+		{
+			name: "bodyless request",
+			raw:  "GET /wait HTTP/1.1\r\n\r\n",
+		},
+		{
+			name: "request with a body",
+			raw:  "POST /wait HTTP/1.1\r\nContent-Length: 3\r\n\r\nabc",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			bodies := make(chan string, 1)
+			cancelled := make(chan error, 1)
+			handler := func(w *response.Writer, req *request.Request) {
+				body, _ := io.ReadAll(req.Body)
+				bodies <- string(body)
+				select {
+				case <-req.Context().Done():
+					cancelled <- req.Context().Err()
+				case <-time.After(2 * time.Second):
+					cancelled <- nil
+				}
+			}
+			client, _ := startConn(t, handler, Config{})
+			go client.Write([]byte(tc.raw))
+
+			<-bodies
+			client.Close()
+			assert.ErrorIs(t, <-cancelled, context.Canceled)
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShutdownClosesIdleConns(t *testing.T) {
+	// Test: Keep-alive connections waiting for a request are closed at once
+	handler := func(w *response.Writer, req *request.Request) {
+		fmt.Fprint(w, "ok")
+	}
+	s, dial := startServer(t, handler, Config{})
+	c := dial()
+	_, err := c.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+	require.NoError(t, err)
+	r := bufio.NewReader(c)
+	_, err = readResponse(r)
+	require.NoError(t, err)
+	idle := dial()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	start := time.Now()
+	require.NoError(t, s.Shutdown(ctx))
+	assert.Less(t, time.Since(start), time.Second)
+
+	_, err = r.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+	_, err = idle.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, io.EOF)
+
+	// Test: New connections are refused
+	_, err = net.DialTimeout("tcp", s.listener.Addr().String(), time.Second)
+	assert.Error(t, err)
+}
+
+func TestShutdownWaitsForHandlers(t *testing.T) {
+	// Test: An in-flight request is answered with Connection: close before
+	// Shutdown returns
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handler := func(w *response.Writer, req *request.Request) {
+		close(started)
+		<-release
+		fmt.Fprint(w, "done")
+	}
+	s, dial := startServer(t, handler, Config{})
+	c := dial()
+	_, err := c.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+	require.NoError(t, err)
+	<-started
+
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- s.Shutdown(context.Background()) }()
+	select {
+	case err := <-shutdown:
+		t.Fatalf("Shutdown returned before the handler finished: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(release)
+
+	out, err := io.ReadAll(c)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(out), "HTTP/1.1 200 OK\r\n"), string(out))
+	assert.Contains(t, string(out), "Connection: close\r\n")
+	assert.True(t, strings.HasSuffix(string(out), "done"), string(out))
+	select {
+	case err := <-shutdown:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Shutdown did not return after the handler finished")
+	}
+}
+
+func TestShutdownContextExpires(t *testing.T) {
+	// Test: Connections still busy when ctx ends are closed forcibly
+	started := make(chan struct{})
+	handlerErr := make(chan error, 1)
+	handler := func(w *response.Writer, req *request.Request) {
+		close(started)
+		<-req.Context().Done()
+		handlerErr <- req.Context().Err()
+	}
+	s, dial := startServer(t, handler, Config{})
+	c := dial()
+	_, err := c.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+	require.NoError(t, err)
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, s.Shutdown(ctx), context.DeadlineExceeded)
+	assert.ErrorIs(t, <-handlerErr, context.Canceled)
+	out, err := io.ReadAll(c)
+	require.NoError(t, err)
+	assert.Empty(t, out)
+}
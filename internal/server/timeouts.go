@@ -0,0 +1,112 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// connTimeouts moves a connection's read deadline between the idle, header and
+// body phases of each request. The reader goroutine and the handler loop both
+// update it, so the state is guarded by mu.
+type connTimeouts struct {
+	conn   net.Conn
+	config Config
+
+	mu           sync.Mutex
+	idle         bool
+	busy         bool
+	requestStart time.Time
+}
+
+func newConnTimeouts(conn net.Conn, config Config) *connTimeouts {
+	return &connTimeouts{conn: conn, config: config}
+}
+
+// Read switches from the idle to the header deadline once the first byte of a
+// new request arrives.
+func (t *connTimeouts) Read(p []byte) (int, error) {
+	n, err := t.conn.Read(p)
+	if n > 0 {
+		t.mu.Lock()
+		if t.idle {
+			t.idle = false
+			t.startRequestLocked()
+		}
+		t.mu.Unlock()
+	}
+	return n, err
+}
+
+func (t *connTimeouts) waitForRequest(buffered bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if buffered {
+		t.idle = false
+		t.startRequestLocked()
+		return
+	}
+	t.idle = true
+	t.armIdleLocked()
+}
+
+func (t *connTimeouts) headersRead() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.conn.SetReadDeadline(deadline(t.requestStart, t.config.ReadTimeout))
+}
+
+// handlerStarted holds off the idle deadline while a response is still being
+// produced, since the client is not expected to send anything meanwhile.
+func (t *connTimeouts) handlerStarted() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.busy = true
+	if t.idle {
+		t.conn.SetReadDeadline(time.Time{})
+	}
+	t.conn.SetWriteDeadline(deadline(time.Now(), t.config.WriteTimeout))
+}
+
+func (t *connTimeouts) handlerDone() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.busy = false
+	if t.idle {
+		t.armIdleLocked()
+	}
+}
+
+// isIdle reports whether the connection was between requests, in which case
+// a timeout is not the client's fault and needs no response.
+func (t *connTimeouts) isIdle() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.idle
+}
+
+func (t *connTimeouts) armIdleLocked() {
+	if t.busy {
+		t.conn.SetReadDeadline(time.Time{})
+		return
+	}
+	t.conn.SetReadDeadline(deadline(time.Now(), t.config.idleTimeout()))
+}
+
+func (t *connTimeouts) startRequestLocked() {
+	t.requestStart = time.Now()
+	t.conn.SetReadDeadline(deadline(t.requestStart, t.config.readHeaderTimeout()))
+}
+
+func deadline(start time.Time, timeout time.Duration) time.Time {
+	if timeout <= 0 {
+		return time.Time{}
+	}
+	return start.Add(timeout)
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
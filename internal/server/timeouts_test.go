@@ -0,0 +1,123 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startServer listens on a free port and returns the server with a function
+// dialling it.
+func startServer(t *testing.T, handler Handler, config Config) (*Server, func() net.Conn) {
+	t.Helper()
+	s, err := ServeWithConfig(0, handler, config)
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+	dial := func() net.Conn {
+		c, err := net.Dial("tcp", s.listener.Addr().String())
+		require.NoError(t, err)
+		t.Cleanup(func() { c.Close() })
+		c.SetDeadline(time.Now().Add(2 * time.Second))
+		return c
+	}
+	return s, dial
+}
+
+func TestServeReadHeaderTimeout(t *testing.T) {
+	// Test: A request line left unfinished gets a 408
+	_, dial := startServer(t, func(w *response.Writer, req *request.Request) {}, Config{ReadHeaderTimeout: 100 * time.Millisecond})
+	c := dial()
+	start := time.Now()
+	_, err := c.Write([]byte("GET / HT"))
+	require.NoError(t, err)
+	out, err := io.ReadAll(c)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(out), "HTTP/1.1 408 Request Timeout\r\n"), string(out))
+	assert.Contains(t, string(out), "Connection: close\r\n")
+	assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+}
+
+func TestServeIdleTimeout(t *testing.T) {
+	handler := func(w *response.Writer, req *request.Request) {
+		fmt.Fprint(w, "ok")
+	}
+	_, dial := startServer(t, handler, Config{IdleTimeout: 100 * time.Millisecond})
+
+	// Test: A keep-alive connection is closed silently once idle
+	c := dial()
+	start := time.Now()
+	_, err := c.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+	require.NoError(t, err)
+	out, err := io.ReadAll(c)
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 2\r\nContent-Type: text/plain\r\n\r\nok", string(out))
+	assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+
+	// Test: So is a connection that never sends a request
+	out, err = io.ReadAll(dial())
+	require.NoError(t, err)
+	assert.Empty(t, out)
+}
+
+func TestServeSlowHandlerNotIdle(t *testing.T) {
+	// Test: The idle deadline doesn't run while a handler is still busy, so
+	// neither the request context nor the connection is cut short
+	ctxErrs := make(chan error, 2)
+	handler := func(w *response.Writer, req *request.Request) {
+		if req.URL.Path == "/slow" {
+			time.Sleep(300 * time.Millisecond)
+		}
+		ctxErrs <- req.Context().Err()
+		fmt.Fprint(w, req.URL.Path)
+	}
+	_, dial := startServer(t, handler, Config{IdleTimeout: 100 * time.Millisecond})
+	c := dial()
+	_, err := c.Write([]byte("GET /slow HTTP/1.1\r\n\r\n"))
+	require.NoError(t, err)
+
+	r := bufio.NewReader(c)
+	resp, err := readResponse(r)
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(resp, "/slow"), resp)
+	assert.NoError(t, <-ctxErrs)
+
+	_, err = c.Write([]byte("GET /next HTTP/1.1\r\n\r\n"))
+	require.NoError(t, err)
+	resp, err = readResponse(r)
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(resp, "/next"), resp)
+	assert.NoError(t, <-ctxErrs)
+}
+
+// readResponse reads one response with a Content-Length body off r.
+func readResponse(r *bufio.Reader) (string, error) {
+	var b strings.Builder
+	length := 0
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return b.String(), err
+		}
+		b.WriteString(line)
+		if line == "\r\n" {
+			break
+		}
+		if v, ok := strings.CutPrefix(line, "Content-Length: "); ok {
+			length, _ = strconv.Atoi(strings.TrimSpace(v))
+		}
+	}
+	body := make([]byte, length)
+	_, err := io.ReadFull(r, body)
+	b.Write(body)
+	return b.String(), err
+}
@@ -0,0 +1,236 @@
+package websocket
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// MessageType is the kind of a data message.
+type MessageType int
+
+const (
+	TextMessage   MessageType = MessageType(opText)
+	BinaryMessage MessageType = MessageType(opBinary)
+)
+
+// closeWriteTimeout bounds how long Close waits to send its close frame to a
+// peer that stopped reading.
+const closeWriteTimeout = time.Second
+
+// DefaultReadLimit caps the size of a reassembled message unless changed
+// with SetReadLimit.
+const DefaultReadLimit = 1 << 20
+
+// Conn is a WebSocket connection. One goroutine may read while others write;
+// writes are serialized.
+type Conn struct {
+	conn     net.Conn
+	br       *bufio.Reader
+	bw       *bufio.Writer
+	isServer bool
+
+	readLimit    int64
+	fragmentSize int
+
+	writeMu   sync.Mutex
+	closeSent bool
+}
+
+func newConn(netConn net.Conn, br *bufio.Reader, bw *bufio.Writer, isServer bool) *Conn {
+	return &Conn{
+		conn:      netConn,
+		br:        br,
+		bw:        bw,
+		isServer:  isServer,
+		readLimit: DefaultReadLimit,
+	}
+}
+
+// SetReadLimit sets the largest message ReadMessage accepts. Anything bigger
+// is refused with close code 1009. Zero or less removes only this message
+// size limit: memory then grows with the data the peer actually sends, not
+// with the frame lengths it announces.
+func (c *Conn) SetReadLimit(n int64) {
+	c.readLimit = n
+}
+
+// SetFragmentSize makes WriteMessage split messages into frames of at most
+// n bytes. Zero, the default, sends every message as a single frame.
+func (c *Conn) SetFragmentSize(n int) {
+	c.fragmentSize = n
+}
+
+// RemoteAddr returns the address of the peer.
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// ReadMessage returns the next data message, reassembling fragmented ones.
+// Pings are answered and pongs dropped along the way. Once the peer sends a
+// close frame it is echoed and a *CloseError is returned; the caller should
+// then Close the connection. On a protocol violation the matching close
+// frame is sent before the error is returned.
+func (c *Conn) ReadMessage() (MessageType, []byte, error) {
+	var (
+		typ       MessageType
+		msg       []byte
+		inMessage bool
+	)
+	for {
+		limit := int64(-1)
+		if c.readLimit > 0 {
+			limit = c.readLimit - int64(len(msg))
+		}
+		f, err := readFrame(c.br, c.isServer, limit)
+		if err != nil {
+			return 0, nil, c.fail(err)
+		}
+
+		switch f.opcode {
+		case opPing:
+			if err := c.writeControl(opPong, f.payload); err != nil && !errors.Is(err, ErrCloseSent) {
+				return 0, nil, err
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			return 0, nil, c.handleClose(f.payload)
+		case opText, opBinary:
+			if inMessage {
+				return 0, nil, c.fail(fmt.Errorf("%w: new message before the last one ended", ErrProtocol))
+			}
+			typ = MessageType(f.opcode)
+			inMessage = true
+		case opContinuation:
+			if !inMessage {
+				return 0, nil, c.fail(fmt.Errorf("%w: continuation without a message", ErrProtocol))
+			}
+		}
+		msg = append(msg, f.payload...)
+		if !f.fin {
+			continue
+		}
+		if typ == TextMessage && !utf8.Valid(msg) {
+			return 0, nil, c.fail(ErrInvalidUTF8)
+		}
+		if msg == nil {
+			msg = []byte{}
+		}
+		return typ, msg, nil
+	}
+}
+
+// handleClose answers a close frame from the peer and reports it.
+func (c *Conn) handleClose(payload []byte) error {
+	closeErr := &CloseError{Code: CloseNoStatus}
+	switch {
+	case len(payload) == 1:
+		return c.fail(fmt.Errorf("%w: one byte close payload", ErrProtocol))
+	case len(payload) >= 2:
+		closeErr.Code = int(binary.BigEndian.Uint16(payload))
+		if !validCloseCode(closeErr.Code) {
+			return c.fail(fmt.Errorf("%w: close code %d", ErrProtocol, closeErr.Code))
+		}
+		if !utf8.Valid(payload[2:]) {
+			return c.fail(ErrInvalidUTF8)
+		}
+		closeErr.Text = string(payload[2:])
+	}
+	// Echo the code back; if we started the close this is the reply.
+	var reply []byte
+	if closeErr.Code != CloseNoStatus {
+		reply = payload[:2]
+	}
+	if err := c.writeControl(opClose, reply); err != nil && !errors.Is(err, ErrCloseSent) {
+		return err
+	}
+	return closeErr
+}
+
+// fail sends the close frame for a protocol error before handing err back.
+func (c *Conn) fail(err error) error {
+	if code := closeCode(err); code != 0 {
+		c.WriteClose(code, "")
+	}
+	return err
+}
+
+// WriteMessage sends a text or binary message. Text must be valid UTF-8.
+func (c *Conn) WriteMessage(typ MessageType, data []byte) error {
+	if typ != TextMessage && typ != BinaryMessage {
+		return fmt.Errorf("unknown message type %d", typ)
+	}
+	if typ == TextMessage && !utf8.Valid(data) {
+		return ErrInvalidUTF8
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closeSent {
+		return ErrCloseSent
+	}
+
+	op := opcode(typ)
+	var buf []byte
+	for {
+		chunk := data
+		if c.fragmentSize > 0 && len(chunk) > c.fragmentSize {
+			chunk = chunk[:c.fragmentSize]
+		}
+		data = data[len(chunk):]
+		buf = appendFrame(buf[:0], frame{fin: len(data) == 0, opcode: op, payload: chunk}, !c.isServer)
+		if _, err := c.bw.Write(buf); err != nil {
+			return err
+		}
+		if len(data) == 0 {
+			break
+		}
+		op = opContinuation
+	}
+	return c.bw.Flush()
+}
+
+// Ping sends a ping with up to 125 bytes of application data. The peer's
+// pong is dropped by ReadMessage.
+func (c *Conn) Ping(data []byte) error {
+	return c.writeControl(opPing, data)
+}
+
+// WriteClose starts the closing handshake. No further messages can be sent;
+// keep calling ReadMessage until it returns the peer's *CloseError.
+func (c *Conn) WriteClose(code int, reason string) error {
+	payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+	return c.writeControl(opClose, append(payload, reason...))
+}
+
+// Close sends a normal close frame unless one was already sent and closes
+// the underlying connection without waiting for the peer's reply.
+func (c *Conn) Close() error {
+	c.conn.SetWriteDeadline(time.Now().Add(closeWriteTimeout))
+	c.WriteClose(CloseNormal, "")
+	return c.conn.Close()
+}
+
+func (c *Conn) writeControl(op opcode, payload []byte) error {
+	if len(payload) > maxControlPayload {
+		return ErrControlTooLong
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closeSent {
+		return ErrCloseSent
+	}
+	if op == opClose {
+		c.closeSent = true
+	}
+	if _, err := c.bw.Write(appendFrame(nil, frame{fin: true, opcode: op, payload: payload}, !c.isServer)); err != nil {
+		return err
+	}
+	return c.bw.Flush()
+}
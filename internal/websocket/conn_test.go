@@ -0,0 +1,305 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// clientFrames encodes frames the way a client sends them, masked.
+func clientFrames(frames ...frame) []byte {
+	var b []byte
+	for _, f := range frames {
+		b = appendFrame(b, f, true)
+	}
+	return b
+}
+
+// serverConn returns a server side Conn reading in and writing to the
+// returned buffer.
+func serverConn(in []byte) (*Conn, *bytes.Buffer) {
+	out := &bytes.Buffer{}
+	c := newConn(nil, bufio.NewReader(bytes.NewReader(in)), bufio.NewWriter(out), true)
+	return c, out
+}
+
+func closePayload(code int, reason string) []byte {
+	return append(binary.BigEndian.AppendUint16(nil, uint16(code)), reason...)
+}
+
+func TestReadMessage(t *testing.T) {
+	// Test: Fragments are reassembled around a ping, which is answered
+	c, out := serverConn(clientFrames(
+		frame{opcode: opText, payload: []byte("Hel")},
+		frame{fin: true, opcode: opPing, payload: []byte("ping")},
+		frame{opcode: opContinuation, payload: []byte("l")},
+		frame{fin: true, opcode: opContinuation, payload: []byte("o")},
+		frame{fin: true, opcode: opPong, payload: []byte("ignored")},
+		frame{fin: true, opcode: opBinary, payload: []byte{0, 1, 2}},
+		frame{fin: true, opcode: opText},
+	))
+	typ, msg, err := c.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, TextMessage, typ)
+	assert.Equal(t, "Hello", string(msg))
+	assert.Equal(t, "\x8a\x04ping", out.String())
+
+	typ, msg, err = c.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, BinaryMessage, typ)
+	assert.Equal(t, []byte{0, 1, 2}, msg)
+
+	typ, msg, err = c.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, TextMessage, typ)
+	assert.Equal(t, []byte{}, msg)
+
+	// Test: Extended payload lengths
+	long := strings.Repeat("x", 70000)
+	c, _ = serverConn(clientFrames(
+		frame{fin: true, opcode: opText, payload: []byte(long[:200])},
+		frame{fin: true, opcode: opText, payload: []byte(long)},
+	))
+	_, msg, err = c.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, long[:200], string(msg))
+	_, msg, err = c.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, long, string(msg))
+
+	// Test: Without a read limit a huge announced length isn't allocated
+	// before the data arrives
+	huge := []byte{0x82, 0x80 | 127}
+	huge = binary.BigEndian.AppendUint64(huge, 1<<62)
+	huge = append(huge, 0, 0, 0, 0, 'x', 'y')
+	c, _ = serverConn(huge)
+	c.SetReadLimit(0)
+	_, _, err = c.ReadMessage()
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+func TestReadMessageErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		in        []byte
+		readLimit int64
+		err       error
+		closeCode int
+	}{
+		{
+			name:      "unmasked frame",
+			in:        appendFrame(nil, frame{fin: true, opcode: opText, payload: []byte("hi")}, false),
+			err:       ErrProtocol,
+			closeCode: CloseProtocolError,
+		},
+		{
+			name:      "reserved bits",
+			in:        append([]byte{0xc1}, clientFrames(frame{fin: true, opcode: opText})[1:]...),
+			err:       ErrProtocol,
+			closeCode: CloseProtocolError,
+		},
+		{
+			name:      "unknown opcode",
+			in:        clientFrames(frame{fin: true, opcode: 0x3}),
+			err:       ErrProtocol,
+			closeCode: CloseProtocolError,
+		},
+		{
+			name:      "fragmented ping",
+			in:        clientFrames(frame{opcode: opPing}),
+			err:       ErrProtocol,
+			closeCode: CloseProtocolError,
+		},
+		{
+			name:      "long ping",
+			in:        clientFrames(frame{fin: true, opcode: opPing, payload: make([]byte, 126)}),
+			err:       ErrControlTooLong,
+			closeCode: CloseProtocolError,
+		},
+		{
+			name:      "continuation without a message",
+			in:        clientFrames(frame{fin: true, opcode: opContinuation, payload: []byte("x")}),
+			err:       ErrProtocol,
+			closeCode: CloseProtocolError,
+		},
+		{
+			name: "new message inside a fragmented one",
+			in: clientFrames(
+				frame{opcode: opText, payload: []byte("a")},
+				frame{fin: true, opcode: opText, payload: []byte("b")},
+			),
+			err:       ErrProtocol,
+			closeCode: CloseProtocolError,
+		},
+		{
+			name:      "length not minimally encoded",
+			in:        []byte{0x81, 0x80 | 126, 0, 5, 0, 0, 0, 0, 'h', 'e', 'l', 'l', 'o'},
+			err:       ErrProtocol,
+			closeCode: CloseProtocolError,
+		},
+		{
+			name:      "invalid UTF-8",
+			in:        clientFrames(frame{fin: true, opcode: opText, payload: []byte{0xff, 0xfe}}),
+			err:       ErrInvalidUTF8,
+			closeCode: CloseInvalidPayload,
+		},
+		{
+			name: "UTF-8 split across fragments",
+			in: clientFrames(
+				frame{opcode: opText, payload: []byte{0xe2, 0x82}},
+				frame{fin: true, opcode: opContinuation, payload: []byte{0xac, 'x'}},
+				frame{fin: true, opcode: opBinary, payload: []byte{0xff}},
+			),
+			readLimit: 16,
+		},
+		{
+			name: "message over the read limit",
+			in: clientFrames(
+				frame{opcode: opBinary, payload: make([]byte, 10)},
+				frame{fin: true, opcode: opContinuation, payload: make([]byte, 10)},
+			),
+			readLimit: 16,
+			err:       ErrMessageTooBig,
+			closeCode: CloseMessageTooBig,
+		},
+		{
+			name:      "invalid close code",
+			in:        clientFrames(frame{fin: true, opcode: opClose, payload: closePayload(1005, "")}),
+			err:       ErrProtocol,
+			closeCode: CloseProtocolError,
+		},
+		{
+			name:      "invalid close reason",
+			in:        clientFrames(frame{fin: true, opcode: opClose, payload: closePayload(CloseNormal, "\xff")}),
+			err:       ErrInvalidUTF8,
+			closeCode: CloseInvalidPayload,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c, out := serverConn(tc.in)
+			if tc.readLimit != 0 {
+				c.SetReadLimit(tc.readLimit)
+			}
+			_, msg, err := c.ReadMessage()
+			if tc.err == nil {
+				require.NoError(t, err)
+				assert.Equal(t, "€x", string(msg))
+				return
+			}
+			assert.ErrorIs(t, err, tc.err)
+			assert.Equal(t, appendFrame(nil, frame{fin: true, opcode: opClose, payload: closePayload(tc.closeCode, "")}, false), out.Bytes())
+			assert.ErrorIs(t, c.WriteMessage(TextMessage, []byte("late")), ErrCloseSent)
+		})
+	}
+}
+
+func TestCloseHandshake(t *testing.T) {
+	// Test: A close from the peer is echoed and reported
+	c, out := serverConn(clientFrames(frame{fin: true, opcode: opClose, payload: closePayload(CloseGoingAway, "bye")}))
+	_, _, err := c.ReadMessage()
+	var closeErr *CloseError
+	require.ErrorAs(t, err, &closeErr)
+	assert.Equal(t, CloseGoingAway, closeErr.Code)
+	assert.Equal(t, "bye", closeErr.Text)
+	assert.Equal(t, "\x88\x02\x03\xe9", out.String())
+	assert.ErrorIs(t, c.WriteMessage(TextMessage, []byte("late")), ErrCloseSent)
+
+	// Test: An empty close is answered with an empty one
+	c, out = serverConn(clientFrames(frame{fin: true, opcode: opClose}))
+	_, _, err = c.ReadMessage()
+	require.ErrorAs(t, err, &closeErr)
+	assert.Equal(t, CloseNoStatus, closeErr.Code)
+	assert.Equal(t, "\x88\x00", out.String())
+
+	// Test: The reply to our own close isn't answered again
+	c, out = serverConn(clientFrames(
+		frame{fin: true, opcode: opText, payload: []byte("in flight")},
+		frame{fin: true, opcode: opClose, payload: closePayload(CloseNormal, "")},
+	))
+	require.NoError(t, c.WriteClose(CloseNormal, "done"))
+	_, msg, err := c.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, "in flight", string(msg))
+	_, _, err = c.ReadMessage()
+	require.ErrorAs(t, err, &closeErr)
+	assert.Equal(t, CloseNormal, closeErr.Code)
+	assert.Equal(t, "\x88\x06\x03\xe8done", out.String())
+}
+
+func TestWriteMessage(t *testing.T) {
+	// Test: Server frames are unmasked
+	c, out := serverConn(nil)
+	require.NoError(t, c.WriteMessage(TextMessage, []byte("hello")))
+	assert.Equal(t, "\x81\x05hello", out.String())
+
+	// Test: Fragmented messages
+	out.Reset()
+	c.SetFragmentSize(2)
+	require.NoError(t, c.WriteMessage(BinaryMessage, []byte("hello")))
+	assert.Equal(t, "\x02\x02he\x00\x02ll\x80\x01o", out.String())
+
+	// Test: Extended lengths
+	out.Reset()
+	c.SetFragmentSize(0)
+	require.NoError(t, c.WriteMessage(BinaryMessage, make([]byte, 300)))
+	assert.Equal(t, []byte{0x82, 126, 0x01, 0x2c}, out.Bytes()[:4])
+	assert.Len(t, out.Bytes(), 304)
+
+	// Test: Control frames
+	out.Reset()
+	require.NoError(t, c.Ping([]byte("are you there")))
+	assert.Equal(t, "\x89\x0dare you there", out.String())
+	assert.ErrorIs(t, c.Ping(make([]byte, 126)), ErrControlTooLong)
+
+	// Test: Invalid messages
+	assert.ErrorIs(t, c.WriteMessage(TextMessage, []byte{0xff}), ErrInvalidUTF8)
+	assert.Error(t, c.WriteMessage(MessageType(opPing), nil))
+}
+
+func TestConnPipe(t *testing.T) {
+	// Test: A masked client and the server talk over a real connection
+	serverNet, clientNet := net.Pipe()
+	server := newConn(serverNet, bufio.NewReader(serverNet), bufio.NewWriter(serverNet), true)
+	client := newConn(clientNet, bufio.NewReader(clientNet), bufio.NewWriter(clientNet), false)
+	client.SetFragmentSize(3)
+
+	done := make(chan error, 1)
+	go func() {
+		for {
+			typ, msg, err := server.ReadMessage()
+			if err != nil {
+				server.Close()
+				done <- err
+				return
+			}
+			if err := server.WriteMessage(typ, bytes.ToUpper(msg)); err != nil {
+				done <- err
+				return
+			}
+		}
+	}()
+
+	for _, text := range []string{"hello", "websocket"} {
+		require.NoError(t, client.WriteMessage(TextMessage, []byte(text)))
+		typ, msg, err := client.ReadMessage()
+		require.NoError(t, err)
+		assert.Equal(t, TextMessage, typ)
+		assert.Equal(t, strings.ToUpper(text), string(msg))
+	}
+
+	require.NoError(t, client.WriteClose(CloseNormal, ""))
+	var closeErr *CloseError
+	_, _, err := client.ReadMessage()
+	require.ErrorAs(t, err, &closeErr)
+	assert.Equal(t, CloseNormal, closeErr.Code)
+	require.ErrorAs(t, <-done, &closeErr)
+	client.Close()
+}
@@ -0,0 +1,77 @@
+package websocket
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Close codes from RFC 6455 7.4.1.
+const (
+	CloseNormal          = 1000
+	CloseGoingAway       = 1001
+	CloseProtocolError   = 1002
+	CloseUnsupportedData = 1003
+	// CloseNoStatus is reported when a close frame carries no code; it is
+	// never sent.
+	CloseNoStatus        = 1005
+	CloseInvalidPayload  = 1007
+	ClosePolicyViolation = 1008
+	CloseMessageTooBig   = 1009
+	CloseInternalError   = 1011
+)
+
+var (
+	ErrBadHandshake   = errors.New("bad websocket handshake")
+	ErrProtocol       = errors.New("websocket protocol violation")
+	ErrInvalidUTF8    = errors.New("text message is not valid UTF-8")
+	ErrMessageTooBig  = errors.New("websocket message too big")
+	ErrCloseSent      = errors.New("websocket close frame already sent")
+	ErrControlTooLong = errors.New("control frame payload longer than 125 bytes")
+)
+
+// closeCodes maps errors found while reading to the code of the close frame
+// sent to the peer before giving up on the connection.
+var closeCodes = map[error]int{
+	ErrProtocol:      CloseProtocolError,
+	ErrInvalidUTF8:   CloseInvalidPayload,
+	ErrMessageTooBig: CloseMessageTooBig,
+}
+
+// CloseError is returned by ReadMessage once the peer has closed the
+// connection with a close frame.
+type CloseError struct {
+	Code int
+	Text string
+}
+
+func (e *CloseError) Error() string {
+	if e.Text == "" {
+		return fmt.Sprintf("websocket closed with code %d", e.Code)
+	}
+	return fmt.Sprintf("websocket closed with code %d: %s", e.Code, e.Text)
+}
+
+// closeCode returns the close code for err, or 0 if err is not a protocol
+// error, e.g. because the connection itself failed.
+func closeCode(err error) int {
+	for target, code := range closeCodes {
+		if errors.Is(err, target) {
+			return code
+		}
+	}
+	return 0
+}
+
+// validCloseCode reports whether code may appear in a close frame received
+// from the peer (RFC 6455 7.4).
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 1000 && code <= 1003:
+		return true
+	case code >= 1007 && code <= 1014:
+		return true
+	case code >= 3000 && code <= 4999:
+		return true
+	}
+	return false
+}
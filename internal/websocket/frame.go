@@ -0,0 +1,185 @@
+package websocket
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+type opcode byte
+
+const (
+	opContinuation opcode = 0x0
+	opText         opcode = 0x1
+	opBinary       opcode = 0x2
+	opClose        opcode = 0x8
+	opPing         opcode = 0x9
+	opPong         opcode = 0xa
+)
+
+const (
+	finBit  = 0x80
+	rsvBits = 0x70
+	maskBit = 0x80
+
+	maxControlPayload = 125
+	// payloadPrealloc is the largest payload allocated up front; longer
+	// ones grow as their bytes arrive.
+	payloadPrealloc = 64 << 10
+)
+
+func (op opcode) isControl() bool {
+	return op&0x8 != 0
+}
+
+func (op opcode) valid() bool {
+	switch op {
+	case opContinuation, opText, opBinary, opClose, opPing, opPong:
+		return true
+	}
+	return false
+}
+
+type frame struct {
+	fin     bool
+	opcode  opcode
+	payload []byte
+}
+
+// readFrame reads one frame and unmasks its payload. Server connections
+// require masked frames and client connections unmasked ones (RFC 6455 5.1).
+// Data payloads longer than limit are refused before they are read; a
+// negative limit allows any length.
+func readFrame(r io.Reader, wantMasked bool, limit int64) (frame, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return frame{}, err
+	}
+	f := frame{
+		fin:    head[0]&finBit != 0,
+		opcode: opcode(head[0] & 0x0f),
+	}
+	if head[0]&rsvBits != 0 {
+		return frame{}, fmt.Errorf("%w: reserved bits set", ErrProtocol)
+	}
+	if !f.opcode.valid() {
+		return frame{}, fmt.Errorf("%w: unknown opcode %#x", ErrProtocol, f.opcode)
+	}
+	masked := head[1]&maskBit != 0
+	if masked != wantMasked {
+		return frame{}, fmt.Errorf("%w: unexpected masking", ErrProtocol)
+	}
+
+	length := uint64(head[1] &^ maskBit)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return frame{}, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+		if length < 126 {
+			return frame{}, fmt.Errorf("%w: length not minimally encoded", ErrProtocol)
+		}
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return frame{}, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+		if length>>63 != 0 || length <= 0xffff {
+			return frame{}, fmt.Errorf("%w: invalid 64-bit length", ErrProtocol)
+		}
+	}
+	if f.opcode.isControl() {
+		if !f.fin {
+			return frame{}, fmt.Errorf("%w: fragmented control frame", ErrProtocol)
+		}
+		if length > maxControlPayload {
+			return frame{}, fmt.Errorf("%w: %w", ErrProtocol, ErrControlTooLong)
+		}
+	}
+	if !f.opcode.isControl() && limit >= 0 && length > uint64(limit) {
+		return frame{}, ErrMessageTooBig
+	}
+
+	var key [4]byte
+	if masked {
+		if _, err := io.ReadFull(r, key[:]); err != nil {
+			return frame{}, err
+		}
+	}
+	payload, err := readPayload(r, length)
+	if err != nil {
+		return frame{}, err
+	}
+	f.payload = payload
+	if masked {
+		maskBytes(key, f.payload)
+	}
+	return f, nil
+}
+
+// readPayload reads n bytes without trusting n for the allocation, since the
+// length comes from the peer: a frame announcing gigabytes only costs memory
+// once the bytes are actually sent.
+func readPayload(r io.Reader, n uint64) ([]byte, error) {
+	if n <= payloadPrealloc {
+		p := make([]byte, n)
+		_, err := io.ReadFull(r, p)
+		return p, err
+	}
+	var buf bytes.Buffer
+	buf.Grow(payloadPrealloc)
+	if _, err := io.CopyN(&buf, r, int64(n)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// appendFrame encodes a frame, masking the payload with a fresh random key
+// if mask is set, as clients must.
+func appendFrame(b []byte, f frame, mask bool) []byte {
+	first := byte(f.opcode)
+	if f.fin {
+		first |= finBit
+	}
+	second := byte(0)
+	if mask {
+		second = maskBit
+	}
+	n := len(f.payload)
+	switch {
+	case n < 126:
+		b = append(b, first, second|byte(n))
+	case n <= 0xffff:
+		b = append(b, first, second|126)
+		b = binary.BigEndian.AppendUint16(b, uint16(n))
+	default:
+		b = append(b, first, second|127)
+		b = binary.BigEndian.AppendUint64(b, uint64(n))
+	}
+	if !mask {
+		return append(b, f.payload...)
+	}
+	var key [4]byte
+	rand.Read(key[:])
+	b = append(b, key[:]...)
+	start := len(b)
+	b = append(b, f.payload...)
+	maskBytes(key, b[start:])
+	return b
+}
+
+// maskBytes applies the masking algorithm of RFC 6455 5.3, which is its own
+// inverse.
+func maskBytes(key [4]byte, p []byte) {
+	for i := range p {
+		p[i] ^= key[i%4]
+	}
+}
@@ -0,0 +1,94 @@
+// Package websocket implements the server side of RFC 6455 on top of a
+// hijacked response.Writer.
+package websocket
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"strings"
+)
+
+// acceptGUID is appended to the client's key before hashing (RFC 6455 1.3).
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// AcceptKey computes the Sec-WebSocket-Accept value for a client's
+// Sec-WebSocket-Key.
+func AcceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// Upgrade checks the opening handshake in req, answers it with 101 Switching
+// Protocols and takes over the connection. If the handshake is invalid it
+// writes an error response instead and returns an error wrapping
+// ErrBadHandshake; the handler should then simply return.
+func Upgrade(w *response.Writer, req *request.Request) (*Conn, error) {
+	key, status, err := checkHandshake(req)
+	if err != nil {
+		rejectHandshake(w, status, err)
+		return nil, err
+	}
+
+	if err := w.WriteStatusLine(response.StatusSwitchingProtocols); err != nil {
+		return nil, err
+	}
+	w.Header.Override("Upgrade", "websocket")
+	w.Header.Override("Connection", "Upgrade")
+	w.Header.Override("Sec-WebSocket-Accept", AcceptKey(key))
+	if err := w.WriteHeaders(); err != nil {
+		return nil, err
+	}
+	netConn, rw, err := w.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	if err := rw.Flush(); err != nil {
+		netConn.Close()
+		return nil, err
+	}
+	return newConn(netConn, rw.Reader, rw.Writer, true), nil
+}
+
+// checkHandshake returns the client's key, or the status to refuse the
+// handshake with.
+func checkHandshake(req *request.Request) (string, response.StatusCode, error) {
+	if req.RequestLine.Method != "GET" {
+		return "", response.StatusMethodNotAllowed, fmt.Errorf("%w: method %s", ErrBadHandshake, req.RequestLine.Method)
+	}
+	if req.RequestLine.HttpVersion != "1.1" {
+		return "", response.StatusBadRequest, fmt.Errorf("%w: HTTP/%s", ErrBadHandshake, req.RequestLine.HttpVersion)
+	}
+	if !req.Headers.HasToken("Connection", "upgrade") || !req.Headers.HasToken("Upgrade", "websocket") {
+		return "", response.StatusUpgradeRequired, fmt.Errorf("%w: not a websocket upgrade", ErrBadHandshake)
+	}
+	if req.Headers.Get("Sec-WebSocket-Version") != "13" {
+		return "", response.StatusUpgradeRequired, fmt.Errorf("%w: unsupported version", ErrBadHandshake)
+	}
+	key := strings.TrimSpace(req.Headers.Get("Sec-WebSocket-Key"))
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		return "", response.StatusBadRequest, fmt.Errorf("%w: invalid Sec-WebSocket-Key", ErrBadHandshake)
+	}
+	return key, 0, nil
+}
+
+func rejectHandshake(w *response.Writer, status response.StatusCode, err error) {
+	if w.Status() != 0 {
+		return
+	}
+	if w.WriteStatusLine(status) != nil {
+		return
+	}
+	switch status {
+	case response.StatusUpgradeRequired:
+		// Tells the client which version we speak (RFC 6455 4.4).
+		w.Header.Override("Upgrade", "websocket")
+		w.Header.Override("Sec-WebSocket-Version", "13")
+	case response.StatusMethodNotAllowed:
+		w.Header.Override("Allow", "GET")
+	}
+	w.Header.Override("Content-Type", "text/plain")
+	w.Write([]byte(err.Error() + "\n"))
+}
@@ -0,0 +1,114 @@
+package websocket
+
+import (
+	"bytes"
+	"httpfromtcp/internal/request"
+	"httpfromtcp/internal/response"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAcceptKey(t *testing.T) {
+	// Test: The sample handshake from RFC 6455 1.3
+	assert.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", AcceptKey("dGhlIHNhbXBsZSBub25jZQ=="))
+}
+
+func parseRequest(t *testing.T, raw string) *request.Request {
+	req, err := request.RequestFromReader(strings.NewReader(raw))
+	require.NoError(t, err)
+	return req
+}
+
+func TestUpgrade(t *testing.T) {
+	// Test: A valid handshake switches protocols and hands over the bytes
+	// that followed the request
+	buf := &bytes.Buffer{}
+	w := response.NewWriter(buf)
+	netConn, _ := net.Pipe()
+	defer netConn.Close()
+	readAhead := appendFrame(nil, frame{fin: true, opcode: opText, payload: []byte("hi")}, true)
+	w.SetHijacker(func() (net.Conn, []byte, error) { return netConn, readAhead, nil })
+	req := parseRequest(t, "GET /ws HTTP/1.1\r\n"+
+		"Host: localhost\r\n"+
+		"Connection: keep-alive, Upgrade\r\n"+
+		"Upgrade: websocket\r\n"+
+		"Sec-WebSocket-Version: 13\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n"+
+		"\r\n")
+	c, err := Upgrade(w, req)
+	require.NoError(t, err)
+	assert.True(t, w.Hijacked())
+	assert.Equal(t, "HTTP/1.1 101 Switching Protocols\r\n"+
+		"Connection: Upgrade\r\n"+
+		"Sec-WebSocket-Accept: s3pPLMBiTxaQ9kYGzzhZRbK+xOo=\r\n"+
+		"Upgrade: websocket\r\n"+
+		"\r\n", buf.String())
+	typ, msg, err := c.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, TextMessage, typ)
+	assert.Equal(t, "hi", string(msg))
+
+	// Test: Invalid handshakes are refused with an error response
+	tests := []struct {
+		name    string
+		raw     string
+		status  string
+		headers []string
+	}{
+		{
+			name:    "wrong method",
+			raw:     "POST /ws HTTP/1.1\r\nConnection: Upgrade\r\nUpgrade: websocket\r\nSec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n",
+			status:  "HTTP/1.1 405 Method Not Allowed\r\n",
+			headers: []string{"Allow: GET\r\n"},
+		},
+		{
+			name:   "HTTP/1.0",
+			raw:    "GET /ws HTTP/1.0\r\nConnection: Upgrade\r\nUpgrade: websocket\r\nSec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n",
+			status: "HTTP/1.0 400 Bad Request\r\n",
+		},
+		{
+			name:    "no upgrade",
+			raw:     "GET /ws HTTP/1.1\r\nSec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n",
+			status:  "HTTP/1.1 426 Upgrade Required\r\n",
+			headers: []string{"Upgrade: websocket\r\n"},
+		},
+		{
+			name:    "old version",
+			raw:     "GET /ws HTTP/1.1\r\nConnection: Upgrade\r\nUpgrade: websocket\r\nSec-WebSocket-Version: 8\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n",
+			status:  "HTTP/1.1 426 Upgrade Required\r\n",
+			headers: []string{"Sec-WebSocket-Version: 13\r\n", "Upgrade: websocket\r\n"},
+		},
+		{
+			name:   "missing key",
+			raw:    "GET /ws HTTP/1.1\r\nConnection: Upgrade\r\nUpgrade: websocket\r\nSec-WebSocket-Version: 13\r\n\r\n",
+			status: "HTTP/1.1 400 Bad Request\r\n",
+		},
+		{
+			name:   "short key",
+			raw:    "GET /ws HTTP/1.1\r\nConnection: Upgrade\r\nUpgrade: websocket\r\nSec-WebSocket-Version: 13\r\nSec-WebSocket-Key: c2hvcnQ=\r\n\r\n",
+			status: "HTTP/1.1 400 Bad Request\r\n",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			w := response.NewWriter(buf)
+			req := parseRequest(t, tc.raw)
+			w.SetHttpVersion(req.RequestLine.HttpVersion)
+			c, err := Upgrade(w, req)
+			assert.ErrorIs(t, err, ErrBadHandshake)
+			assert.Nil(t, c)
+			require.NoError(t, w.Finish())
+			out := buf.String()
+			assert.True(t, strings.HasPrefix(out, tc.status), out)
+			for _, h := range tc.headers {
+				assert.Contains(t, out, h)
+			}
+			assert.False(t, w.Hijacked())
+		})
+	}
+}